@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import "purplekraken.com/pkg/gojail/syscall"
+
+// Backend performs the jail system calls on behalf of the package.
+//
+// The parameters are passed as in jail_set(2) and jail_get(2): an array of
+// name and value pairs, with the names NUL-terminated.
+// On success, JailGet shortens the value slices to the length reported by
+// the kernel, like jail_get(2) does with the iov_len fields.
+// Errors are returned as syscall.Errno values, if the request includes an
+// "errmsg" parameter, it receives the error message from the jail subsystem.
+type Backend interface {
+	JailSet(iov [][]byte, flags Flags) (int, error)
+	JailGet(iov [][]byte, flags Flags) (int, error)
+	JailAttach(jid int) error
+	JailRemove(jid int) error
+}
+
+// Backend using the system calls of the running kernel.
+type sysBackend struct{}
+
+func (sysBackend) JailSet(iov [][]byte, flags Flags) (int, error) {
+	return syscall.JailSet(iov, int(flags))
+}
+
+func (sysBackend) JailGet(iov [][]byte, flags Flags) (int, error) {
+	return syscall.JailGet(iov, int(flags))
+}
+
+func (sysBackend) JailAttach(jid int) error {
+	return syscall.JailAttach(jid)
+}
+
+func (sysBackend) JailRemove(jid int) error {
+	return syscall.JailRemove(jid)
+}
+
+var backend Backend = sysBackend{}
+
+// SetBackend replaces the backend used by all functions of the package and
+// returns the previous one.
+// Passing nil restores the system call backend.
+// SetBackend must not be called concurrently with other functions of the
+// package, it is meant to be used during initialization or in tests.
+func SetBackend(b Backend) Backend {
+	prev := backend
+	if b == nil {
+		b = sysBackend{}
+	}
+	backend = b
+	return prev
+}
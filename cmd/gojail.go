@@ -27,27 +27,155 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/jailconf"
+	"purplekraken.com/pkg/gojail/pty"
 )
 
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gojail name")
+	fmt.Fprintln(os.Stderr, "       gojail console [-u user] name")
+	fmt.Fprintln(os.Stderr, "       gojail fmt [-l] [-w] [file ...]")
+	os.Exit(2)
+}
+
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "usage: gojail name")
-		os.Exit(2)
+		usage()
+	}
+	switch os.Args[1] {
+	case "fmt":
+		os.Exit(formatFiles(os.Args[2:]))
+	case "console":
+		os.Exit(console(os.Args[2:]))
 	}
-	jid, err := gojail.GetId(os.Args[1])
+	jid, err := getId(os.Args[1])
 	if err != nil {
-		if je, ok := err.(*gojail.JailErr); ok {
-			fmt.Fprintln(os.Stderr, "gojail: errmsg:", je)
-		} else if sce, ok := err.(*os.SyscallError); ok {
-			fmt.Fprintln(os.Stderr, "gojail: syscall:", sce)
+		os.Exit(1)
+	}
+	fmt.Println(jid)
+}
+
+// Like gojail.GetId, but reports errors on standard error.
+func getId(name string) (int, error) {
+	jid, err := gojail.GetId(name)
+	if err != nil {
+		if errors.Is(err, gojail.ErrNotFound) {
+			fmt.Fprintln(os.Stderr, "gojail: no such jail:", name)
 		} else {
 			fmt.Fprintln(os.Stderr, "gojail:", err)
 		}
-		os.Exit(1)
 	}
-	fmt.Println(jid)
+	return jid, err
+}
+
+// Logs into a jail on a pseudo-terminal connected to the terminal of
+// gojail. Returns the exit status.
+func console(args []string) int {
+	fs := flag.NewFlagSet("console", flag.ExitOnError)
+	user := fs.String("u", "root", "user to log in as")
+	fs.Usage = usage
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	jid, err := getId(fs.Arg(0))
+	if err != nil {
+		return 1
+	}
+
+	p, err := pty.Start(gojail.Command(jid, "/usr/bin/login", "-f", *user))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gojail:", err)
+		return 1
+	}
+	defer p.Close()
+	if restore, err := pty.MakeRaw(os.Stdin); err == nil {
+		defer restore()
+		stop := p.ForwardResize(os.Stdin)
+		defer stop()
+	}
+	go io.Copy(p, os.Stdin)
+	// Fails with EIO once the session ends and the terminal is closed.
+	io.Copy(os.Stdout, p)
+
+	if err := p.Cmd.Wait(); err != nil {
+		if p.Cmd.ProcessState != nil {
+			return p.Cmd.ProcessState.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, "gojail:", err)
+		return 1
+	}
+	return 0
+}
+
+// Formats jail.conf files like gofmt, from standard input if no files are
+// given. Returns the exit status.
+func formatFiles(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := fs.Bool("l", false, "list files whose formatting differs")
+	write := fs.Bool("w", false, "write the result to the file instead of standard output")
+	fs.Usage = usage
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "gojail: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = formatFile("<standard input>", src, *list, false)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gojail:", err)
+			return 1
+		}
+		return 0
+	}
+	status := 0
+	for _, path := range fs.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			err = formatFile(path, src, *list, *write)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gojail:", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func formatFile(path string, src []byte, list, write bool) error {
+	f, err := jailconf.Parse(path, src)
+	if err != nil {
+		return err
+	}
+	out := jailconf.Print(f)
+	changed := !bytes.Equal(src, out)
+	if list && changed {
+		fmt.Println(path)
+	}
+	if write {
+		if !changed {
+			return nil
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, out, fi.Mode().Perm())
+	}
+	if !list {
+		_, err = os.Stdout.Write(out)
+	}
+	return err
 }
@@ -0,0 +1,424 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	sys "syscall"
+
+	"golang.org/x/sys/unix"
+	"purplekraken.com/pkg/gojail/passwd"
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+// Environment variables passing the parameters of a command to the helper
+// process.
+const (
+	helperJIDEnv   = "_GOJAIL_HELPER_JID"
+	helperPathEnv  = "_GOJAIL_HELPER_PATH"
+	helperDirEnv   = "_GOJAIL_HELPER_DIR"
+	helperUserEnv  = "_GOJAIL_HELPER_USER"
+	helperHostEnv  = "_GOJAIL_HELPER_HOSTUSER"
+	helperCleanEnv = "_GOJAIL_HELPER_CLEAN"
+)
+
+var helperEnv = []string{helperJIDEnv, helperPathEnv, helperDirEnv, helperUserEnv, helperHostEnv, helperCleanEnv}
+
+// File descriptor of the pipe the helper reports errors on.
+const helperStatusFd = 3
+
+// Exit status of the helper if it fails before running the command.
+const helperFailed = 127
+
+// Cmd is a command run in a jail, like exec.Cmd.
+//
+// The command is started by re-executing the running program as a helper,
+// which attaches to the jail and then executes the command, so the calling
+// process is never attached to the jail.
+// The helper is run by the initialization of this package, which happens
+// before the main function of the program.
+type Cmd struct {
+	// The jail to run the command in.
+	JID int
+	// The path of the command within the jail. If it contains no slash,
+	// it is looked up in the PATH of Env within the jail.
+	Path string
+	// The arguments of the command, including the command name as
+	// Args[0].
+	Args []string
+	// The environment of the command, the environment of the calling
+	// process if nil.
+	// With Clean, the variables are added to the clean environment.
+	Env []string
+	// The working directory within the jail, the root of the jail if
+	// empty, or the home directory of the user with Clean.
+	Dir string
+
+	// The user to run the command as, by name or ID, with its groups and
+	// the umask of its login class.
+	// The user is looked up in the passwd database of the jail, like
+	// jexec -U does, or of the host if HostUser is set, like jexec -u.
+	// If empty, the command runs with the credentials of the calling
+	// process.
+	User     string
+	HostUser bool
+	// Clean runs the command in a clean environment, like jexec -l:
+	// HOME, SHELL, USER, LOGNAME, PATH and the variables of the login
+	// class of the user, TERM of the calling process and Env.
+	Clean bool
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Attributes of the helper process, which the command inherits, like
+	// a new session with a controlling terminal.
+	SysProcAttr *sys.SysProcAttr
+
+	// The underlying process, set by Start.
+	Process *os.Process
+	// Information about the exited process, set by Wait.
+	ProcessState *os.ProcessState
+
+	cmd *exec.Cmd
+}
+
+// Command returns a command which runs the program name with the given
+// arguments in the jail jid.
+func Command(jid int, name string, args ...string) *Cmd {
+	return &Cmd{
+		JID:  jid,
+		Path: name,
+		Args: append([]string{name}, args...),
+	}
+}
+
+func (c *Cmd) String() string {
+	return fmt.Sprintf("jail %d: %s", c.JID, strings.Join(c.Args, " "))
+}
+
+// Start starts the command, but does not wait for it to finish.
+// Errors attaching to the jail or executing the command are returned by
+// Start.
+func (c *Cmd) Start() error {
+	if c.cmd != nil {
+		return errors.New("gojail: command already started")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	env := c.Env
+	if c.Clean {
+		if term, ok := os.LookupEnv("TERM"); ok {
+			env = append([]string{"TERM=" + term}, env...)
+		}
+	} else if env == nil {
+		env = os.Environ()
+	}
+	flag := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return ""
+	}
+	args := c.Args
+	if len(args) == 0 {
+		args = []string{c.Path}
+	}
+	cmd := &exec.Cmd{
+		Path:        self,
+		Args:        args,
+		Stdin:       c.Stdin,
+		Stdout:      c.Stdout,
+		Stderr:      c.Stderr,
+		SysProcAttr: c.SysProcAttr,
+		Env: append(env[:len(env):len(env)],
+			helperJIDEnv+"="+strconv.Itoa(c.JID),
+			helperPathEnv+"="+c.Path,
+			helperDirEnv+"="+c.Dir,
+			helperUserEnv+"="+c.User,
+			helperHostEnv+"="+flag(c.HostUser),
+			helperCleanEnv+"="+flag(c.Clean)),
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cmd.ExtraFiles = []*os.File{w}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	c.cmd = cmd
+	c.Process = cmd.Process
+
+	// The pipe is closed without data once the command was executed.
+	status, err := io.ReadAll(r)
+	if err == nil && len(status) > 0 {
+		err = helperError(status)
+	}
+	if err != nil {
+		cmd.Wait()
+		c.ProcessState = cmd.ProcessState
+		return err
+	}
+	return nil
+}
+
+// Wait waits for the command to exit, like exec.Cmd.Wait.
+// A non-zero exit status is reported as *exec.ExitError.
+func (c *Cmd) Wait() error {
+	if c.cmd == nil {
+		return errors.New("gojail: command not started")
+	}
+	if c.ProcessState != nil {
+		return errors.New("gojail: Wait was already called")
+	}
+	err := c.cmd.Wait()
+	c.ProcessState = c.cmd.ProcessState
+	return err
+}
+
+// Run starts the command and waits for it to finish.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output.
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("gojail: Stdout already set")
+	}
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	err := c.Run()
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its standard output and
+// standard error.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil || c.Stderr != nil {
+		return nil, errors.New("gojail: Stdout or Stderr already set")
+	}
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = &out
+	err := c.Run()
+	return out.Bytes(), err
+}
+
+// Reports an error of the helper to the parent, as the failed operation,
+// the error number and the path involved, separated by newlines.
+func reportHelperError(op string, errno sys.Errno, path string) {
+	f := os.NewFile(helperStatusFd, "status")
+	fmt.Fprintf(f, "%s\n%d\n%s", op, errno, path)
+	os.Exit(helperFailed)
+}
+
+// Decodes an error reported by reportHelperError.
+func helperError(status []byte) error {
+	fields := strings.SplitN(string(status), "\n", 3)
+	if len(fields) != 3 {
+		return fmt.Errorf("gojail: invalid status from helper: %q", status)
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return fmt.Errorf("gojail: invalid status from helper: %q", status)
+	}
+	errno := sys.Errno(n)
+	switch fields[0] {
+	case "jail_attach":
+		return syscallError(fields[0], errno)
+	case "lookup":
+		return errors.New("gojail: " + fields[2])
+	}
+	return &os.PathError{Op: fields[0], Path: fields[2], Err: errno}
+}
+
+// Returns the errno of err, or EINVAL if it has none.
+func errnoOf(err error) sys.Errno {
+	var errno sys.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return sys.ENOENT
+	}
+	return sys.EINVAL
+}
+
+// Runs the helper if the program was started by Cmd.Start.
+func init() {
+	if jid := os.Getenv(helperJIDEnv); jid != "" {
+		runHelper(jid)
+	}
+}
+
+// Attaches to the jail and executes the command, never returns.
+func runHelper(jidText string) {
+	path := os.Getenv(helperPathEnv)
+	dir := os.Getenv(helperDirEnv)
+	userName := os.Getenv(helperUserEnv)
+	hostUser := os.Getenv(helperHostEnv) != ""
+	clean := os.Getenv(helperCleanEnv) != ""
+	for _, name := range helperEnv {
+		os.Unsetenv(name)
+	}
+	unix.CloseOnExec(helperStatusFd)
+
+	jid, err := strconv.Atoi(jidText)
+	if err != nil {
+		reportHelperError("jail_attach", sys.EINVAL, "")
+	}
+	var u *passwd.User
+	var gids []int
+	if userName != "" && hostUser {
+		u, gids = lookupHelperUser(userName)
+	}
+	if err := syscall.JailAttach(jid); err != nil {
+		reportHelperError("jail_attach", errnoOf(err), "")
+	}
+	if u == nil && (userName != "" || clean) {
+		u, gids = lookupHelperUser(userName)
+	}
+	env := os.Environ()
+	if u != nil {
+		class, err := passwd.LookupClass("/", passwd.ClassOf(u))
+		if err != nil {
+			reportHelperError("lookup", 0, err.Error())
+		}
+		if userName != "" {
+			if err := sys.Setgroups(gids); err != nil {
+				reportHelperError("setgroups", errnoOf(err), "")
+			}
+			if err := sys.Setgid(u.GID); err != nil {
+				reportHelperError("setgid", errnoOf(err), "")
+			}
+			if err := sys.Setuid(u.UID); err != nil {
+				reportHelperError("setuid", errnoOf(err), "")
+			}
+		}
+		if umask, ok := class.Umask(); ok {
+			unix.Umask(umask)
+		}
+		if clean {
+			env = append(cleanEnv(u, class), env...)
+			if dir == "" {
+				dir = u.Home
+				if _, err := os.Stat(dir); err != nil {
+					dir = "/"
+				}
+			}
+		}
+	}
+	if dir == "" {
+		dir = "/"
+	}
+	if err := os.Chdir(dir); err != nil {
+		reportHelperError("chdir", errnoOf(err), dir)
+	}
+	if !strings.Contains(path, "/") {
+		lp, err := lookPath(path, env)
+		if err != nil {
+			reportHelperError("exec", errnoOf(err), path)
+		}
+		path = lp
+	}
+	err = sys.Exec(path, os.Args, env)
+	reportHelperError("exec", errnoOf(err), path)
+}
+
+// Looks up the user of the helper, the current user if name is empty, in
+// the passwd database of the current root directory.
+func lookupHelperUser(name string) (*passwd.User, []int) {
+	var u *passwd.User
+	var err error
+	if name == "" {
+		u, err = passwd.LookupUserID("/", os.Getuid())
+	} else {
+		u, err = passwd.LookupUser("/", name)
+	}
+	if err != nil {
+		reportHelperError("lookup", 0, err.Error())
+	}
+	gids, err := passwd.GroupIDs("/", u)
+	if err != nil {
+		reportHelperError("lookup", 0, err.Error())
+	}
+	return u, gids
+}
+
+// Returns the clean environment of a login of u, like jexec -l.
+func cleanEnv(u *passwd.User, class *passwd.LoginClass) []string {
+	shell := u.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	env := []string{
+		"HOME=" + u.Home,
+		"SHELL=" + shell,
+		"USER=" + u.Name,
+		"LOGNAME=" + u.Name,
+		"PATH=" + strings.Join(class.Path(u), ":"),
+	}
+	return append(env, class.Env(u)...)
+}
+
+// Looks up file in the PATH of env, like exec.LookPath.
+func lookPath(file string, env []string) (string, error) {
+	path := ""
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			path = kv[len("PATH="):]
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		p := filepath.Join(dir, file)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() && fi.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return "", exec.ErrNotFound
+}
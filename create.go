@@ -0,0 +1,328 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	sys "syscall"
+)
+
+// Option sets parameters of a jail created or updated by Create, Update or
+// Ensure.
+type Option func(*options)
+
+type options struct {
+	params []JailParam
+	errs   []error
+}
+
+// Adds p, replacing an earlier parameter of the same name.
+func (o *options) add(p JailParam, err error) {
+	if err != nil {
+		o.errs = append(o.errs, err)
+		return
+	}
+	for i, q := range o.params {
+		if cstring(q.Name()) == cstring(p.Name()) {
+			o.params[i] = p
+			return
+		}
+	}
+	o.params = append(o.params, p)
+}
+
+// Returns the parameter called name, nil if it is not set.
+func (o *options) get(name string) JailParam {
+	for _, p := range o.params {
+		if cstring(p.Name()) == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Returns the textual value of the parameter called name, or an empty
+// string.
+func (o *options) text(name string) string {
+	if p := o.get(name); p != nil {
+		s, _ := Export(p)
+		return s
+	}
+	return ""
+}
+
+// Appends addrs to the list valued parameter called name.
+func (o *options) appendList(name string, addrs []string) {
+	list := strings.Join(addrs, ",")
+	if prev := o.text(name); prev != "" {
+		list = prev + "," + list
+	}
+	o.add(Import(name, list))
+}
+
+// WithParam sets the parameter called name to the textual value, see
+// Import.
+func WithParam(name, value string) Option {
+	return func(o *options) {
+		o.add(Import(name, value))
+	}
+}
+
+// WithParams sets the given parameters.
+func WithParams(params ...JailParam) Option {
+	return func(o *options) {
+		for _, p := range params {
+			o.add(p, nil)
+		}
+	}
+}
+
+// WithPath sets the root directory of the jail.
+func WithPath(path string) Option {
+	return WithParam("path", path)
+}
+
+// WithHostname sets the hostname of the jail.
+func WithHostname(hostname string) Option {
+	return WithParam("host.hostname", hostname)
+}
+
+// WithIPv4 adds IPv4 addresses to the jail.
+func WithIPv4(addrs ...string) Option {
+	return func(o *options) {
+		o.appendList("ip4.addr", addrs)
+	}
+}
+
+// WithIPv6 adds IPv6 addresses to the jail.
+func WithIPv6(addrs ...string) Option {
+	return func(o *options) {
+		o.appendList("ip6.addr", addrs)
+	}
+}
+
+// Persist keeps the jail alive without any processes.
+// Jails created without it vanish immediately, unless a process is attached
+// to them.
+func Persist() Option {
+	return WithParam("persist", "")
+}
+
+// Securelevel sets the securelevel of the jail, between -1 and 3.
+func Securelevel(level int) Option {
+	return func(o *options) {
+		if level < -1 || level > 3 {
+			o.add(nil, invalidParamError("securelevel must be between -1 and 3: %d", level))
+			return
+		}
+		o.add(NewIntParam("securelevel", level))
+	}
+}
+
+// Allow sets the given permissions of the jail, named without the "allow."
+// prefix, like "raw_sockets" or "mount.devfs".
+func Allow(perms ...string) Option {
+	return func(o *options) {
+		for _, perm := range perms {
+			o.add(Import("allow."+perm, "true"))
+		}
+	}
+}
+
+// Vnet gives the jail a virtual network stack of its own, see
+// NewVnetParam.
+func Vnet() Option {
+	return func(o *options) {
+		o.add(NewVnetParam(true))
+	}
+}
+
+// Checks combinations of parameters the kernel would reject.
+func (o *options) validate() {
+	for _, family := range []string{"ip4", "ip6"} {
+		if o.text(family+".addr") == "" {
+			continue
+		}
+		if mode := o.text(family); mode != "" && mode != "new" {
+			o.errs = append(o.errs, invalidParamError("%s.addr requires %s=new, not %s", family, family, mode))
+		}
+		if o.text("vnet") == "new" {
+			o.errs = append(o.errs, invalidParamError("%s.addr cannot be set for vnet jails", family))
+		}
+	}
+}
+
+// Collects all errors from the options.
+type errorList []error
+
+func (l errorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches target.
+func (l errorList) Is(target error) bool {
+	for _, err := range l {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error matching target, see errors.As.
+func (l errorList) As(target interface{}) bool {
+	for _, err := range l {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the errors.
+func (l errorList) Unwrap() []error {
+	return l
+}
+
+// Applies opts and returns the parameters for the jail called name.
+func buildParams(name string, opts []Option) ([]JailParam, error) {
+	o := &options{}
+	if name == "" {
+		o.errs = append(o.errs, invalidParamError("jail name must not be empty"))
+	} else if _, err := strconv.Atoi(name); err == nil {
+		o.errs = append(o.errs, invalidParamError("jail name must not be numeric: %s", name))
+	}
+	o.add(NewStringParam("name", name))
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.validate()
+	switch len(o.errs) {
+	case 0:
+		return o.params, nil
+	case 1:
+		return nil, o.errs[0]
+	}
+	return nil, errorList(o.errs)
+}
+
+// Create creates the jail called name with a single call to SetParams.
+// Errors from the options are collected and reported together, before the
+// jail is created.
+// Like jail_set(2), it does not add interface aliases for the addresses or
+// mount file systems, see the lifecycle and network packages.
+//
+//	j, err := gojail.Create("www",
+//		gojail.WithPath("/jails/www"),
+//		gojail.WithHostname("www.example.org"),
+//		gojail.WithIPv4("192.0.2.1"),
+//		gojail.Persist())
+func Create(name string, opts ...Option) (*Jail, error) {
+	params, err := buildParams(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewJail(params, CreateFlag)
+}
+
+// Update updates the existing jail called name, like Create.
+func Update(name string, opts ...Option) (*Jail, error) {
+	params, err := buildParams(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewJail(params, UpdateFlag)
+}
+
+// Ensure creates the jail called name, or updates it if it exists.
+// Parameters which can only be set on creation, like path, must match the
+// existing jail.
+// Creating the jail is tried first, so a jail created concurrently is
+// updated instead of failing with ErrExists.
+func Ensure(name string, opts ...Option) (*Jail, error) {
+	params, err := buildParams(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	for retried := false; ; retried = true {
+		j, err := NewJail(params, CreateFlag)
+		// Only a jail of the same name, not an address clash.
+		if !errors.Is(err, sys.EEXIST) {
+			return j, err
+		}
+		j, err = Open(name)
+		if errors.Is(err, ErrNotFound) && !retried {
+			// Removed in the meantime, try to create it again.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return ensureUpdate(j, name, params)
+	}
+}
+
+// Updates the existing jail j with params, which must not change its
+// creation-only parameters.
+func ensureUpdate(j *Jail, name string, params []JailParam) (*Jail, error) {
+	// Drop the name and the creation-only parameters matching the jail.
+	var update []JailParam
+	for _, p := range params {
+		pname := cstring(p.Name())
+		if pname == "name" {
+			continue
+		}
+		info, ok := LookupParam(pname)
+		if !ok || !info.CreateOnly {
+			update = append(update, p)
+			continue
+		}
+		want, err := Export(p)
+		if err != nil {
+			return nil, err
+		}
+		out, err := Want(pname)
+		if err != nil {
+			return nil, err
+		}
+		if err := j.Params(out); err != nil {
+			return nil, err
+		}
+		if have := out.String(); have != want {
+			return nil, invalidParamError("%s of jail %s cannot be changed from %s to %s", pname, name, have, want)
+		}
+	}
+	if err := j.Update(update...); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
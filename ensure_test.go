@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"reflect"
+	sys "syscall"
+	"testing"
+
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+// Backend for a single existing jail "www" at /jails/www, recording the
+// parameters of updates.
+type ensureBackend struct {
+	updated []string
+}
+
+func (b *ensureBackend) JailSet(iov [][]byte, flags Flags) (int, error) {
+	if flags&CreateFlag != 0 {
+		return -1, sys.EEXIST
+	}
+	for i := 0; i+1 < len(iov); i += 2 {
+		if name := cstring(iov[i]); name != "errmsg" {
+			b.updated = append(b.updated, name)
+		}
+	}
+	return 1, nil
+}
+
+func (b *ensureBackend) JailGet(iov [][]byte, flags Flags) (int, error) {
+	values := map[string]string{"name": "www", "path": "/jails/www"}
+	for i := 0; i+1 < len(iov); i += 2 {
+		if v, ok := values[cstring(iov[i])]; ok && len(iov[i+1]) > len(v) {
+			n := copy(iov[i+1], v+"\x00")
+			iov[i+1] = iov[i+1][:n]
+		}
+	}
+	return 1, nil
+}
+
+func (b *ensureBackend) JailAttach(jid int) error { return sys.ENOSYS }
+func (b *ensureBackend) JailRemove(jid int) error { return sys.ENOSYS }
+
+func TestEnsureCreateOnly(t *testing.T) {
+	// The flags of the security.jail.param nodes of the kernel.
+	const rw = syscall.CTLFLAG_RD | syscall.CTLFLAG_WR
+	const rdtun = syscall.CTLFLAG_RD | syscall.CTLFLAG_TUN
+	nodes := []struct {
+		name   string
+		kind   uint32
+		format string
+		value  []byte
+	}{
+		{"jid", syscall.CTLTYPE_INT | rdtun, "I", intToBytes(0)},
+		{"name", syscall.CTLTYPE_STRING | rw, "A", []byte("256\x00")},
+		{"path", syscall.CTLTYPE_STRING | rdtun, "A", []byte("1024\x00")},
+		{"securelevel", syscall.CTLTYPE_INT | rw, "I", intToBytes(0)},
+		{"persist", syscall.CTLTYPE_INT | rw, "B", intToBytes(0)},
+	}
+	var infos []ParamInfo
+	for _, n := range nodes {
+		info, ok := sysctlParamInfo(n.name, n.kind, n.format, n.value)
+		if !ok {
+			t.Fatalf("%s: invalid node", n.name)
+		}
+		infos = append(infos, info)
+	}
+	DefaultRegistry()
+	prevRegistry := defaultRegistry
+	defaultRegistry = NewRegistry(infos)
+	defer func() { defaultRegistry = prevRegistry }()
+	b := &ensureBackend{}
+	prev := SetBackend(b)
+	defer SetBackend(prev)
+
+	if _, err := Ensure("www", WithPath("/jails/www"), Securelevel(2)); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if want := []string{"jid", "securelevel"}; !reflect.DeepEqual(b.updated, want) {
+		t.Errorf("expected update of %q, got %q", want, b.updated)
+	}
+}
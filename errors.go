@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	sys "syscall"
+)
+
+// Error message from the jail subsystem.
+// Represents an error returned as the "errmsg" parameter from JailGet or JailSet.
+// Errors from system calls without a message are reported with the
+// description of the error number instead.
+//
+// Use errors.Is to check for one of the sentinel errors like ErrNotFound,
+// or for the error number itself.
+type JailErr struct {
+	Op     string    // System call which failed, empty if unknown
+	Errno  sys.Errno // Error number returned by the system call, 0 if unknown
+	errmsg string
+	dying  bool
+}
+
+func (je *JailErr) Error() string {
+	if je.Op == "" {
+		return je.errmsg
+	}
+	return je.Op + ": " + je.errmsg
+}
+
+// Message returns the error message of the jail subsystem.
+func (je *JailErr) Message() string {
+	return je.errmsg
+}
+
+// Unwrap returns the error number as *os.SyscallError, or as is if the
+// system call is unknown.
+func (je *JailErr) Unwrap() error {
+	if je.Errno == 0 {
+		return nil
+	}
+	if je.Op == "" {
+		return je.Errno
+	}
+	return os.NewSyscallError(je.Op, je.Errno)
+}
+
+// Is reports whether the error matches one of the sentinel errors of the
+// package.
+func (je *JailErr) Is(target error) bool {
+	switch target {
+	case ErrNotFound, ErrPermission, ErrInvalidParam, ErrNotSupported:
+		return je.Errno == target.(*JailErr).Errno
+	case ErrExists:
+		return je.Errno == sys.EEXIST || je.Errno == sys.EADDRINUSE
+	case ErrBusy:
+		return je.Errno == sys.EBUSY || je.Errno == sys.EAGAIN
+	case ErrDying:
+		return je.dying
+	}
+	return false
+}
+
+// Sentinel errors, compare using errors.Is.
+var (
+	// The jail does not exist.
+	ErrNotFound error = &JailErr{Errno: sys.ENOENT, errmsg: "No such jail"}
+	// The jail or a resource it needs, like its name or address,
+	// already exists. Matches EEXIST and EADDRINUSE.
+	ErrExists error = &JailErr{Errno: sys.EEXIST, errmsg: "jail already exists"}
+	// The process lacks the privileges for the operation.
+	ErrPermission error = &JailErr{Errno: sys.EPERM, errmsg: "operation not permitted"}
+	// A parameter is unknown, of the wrong type or has an invalid value.
+	ErrInvalidParam error = &JailErr{Errno: sys.EINVAL, errmsg: "invalid parameter"}
+	// The jail is being removed.
+	ErrDying error = &JailErr{errmsg: "jail is dying", dying: true}
+	// The kernel is out of a resource, like free JIDs, or the resource is
+	// in use.
+	ErrBusy error = &JailErr{Errno: sys.EBUSY, errmsg: "resource busy"}
+	// The system does not support jails, returned by all system calls
+	// on systems other than FreeBSD.
+	ErrNotSupported error = &JailErr{Errno: sys.ENOSYS, errmsg: "jails are not supported on this system"}
+)
+
+// Error returned by GetId and GetName if the specified jail does not exist.
+// It is the same as ErrNotFound.
+var NoJail error = ErrNotFound
+
+// Returns a *JailErr for the errmsg of the system call op.
+// Whether the jail is dying is detected from the request by
+// callWithErrmsg, the " is dying" suffix of the messages of the kernel
+// is only a fallback.
+func newJailErr(op string, errno sys.Errno, errmsg string) *JailErr {
+	return &JailErr{
+		Op:     op,
+		Errno:  errno,
+		errmsg: errmsg,
+		dying:  strings.HasSuffix(errmsg, " is dying"),
+	}
+}
+
+// Converts errno values returned by the system call op to *JailErr.
+func syscallError(op string, err error) error {
+	if errno, ok := err.(sys.Errno); ok {
+		if errno == sys.ENOSYS {
+			return newJailErr(op, errno, ErrNotSupported.(*JailErr).errmsg)
+		}
+		return newJailErr(op, errno, errno.Error())
+	}
+	return err
+}
+
+// Returns an error matching ErrInvalidParam.
+func invalidParamError(format string, args ...interface{}) error {
+	return &JailErr{
+		Errno:  sys.EINVAL,
+		errmsg: fmt.Sprintf(format, args...),
+	}
+}
@@ -40,61 +40,22 @@ func main() {
 		os.Exit(2)
 	}
 
-	params := []gojail.JailParam{}
-	name, err := gojail.NewStringParam("name", os.Args[1])
-	if err != nil {
-		panic(err)
-	}
-	params = append(params, name)
-
-	hostname, err := gojail.NewStringParam("host.hostname", os.Args[2])
-	if err != nil {
-		doError(err.Error())
-	}
-	params = append(params, hostname)
-
-	path, err := gojail.NewStringParam("path", os.Args[3])
-	if err != nil {
-		doError(err.Error())
-	}
-	params = append(params, path)
-
-	persist, err := gojail.NewStringParam("persist", "")
-	if err != nil {
-		doError(err.Error())
-	}
-	params = append(params, persist)
-
 	secureint, err := strconv.Atoi(os.Args[4])
-	if err != nil || secureint < 0 || secureint > 3 {
-		doError("Invalid securelevel provided, must be a number between 0 and 3")
-	}
-
-	securelevel, err := gojail.NewIntParam("securelevel", secureint)
 	if err != nil {
-		doError(err.Error())
+		doError("Invalid securelevel provided, must be a number between -1 and 3")
 	}
-	params = append(params, securelevel)
-
-	ip4, err := gojail.NewIPParam(os.Args[5])
-	if err != nil {
-		doError(err.Error())
-	}
-	params = append(params, ip4)
-
-	jid, err := gojail.SetParams(params, gojail.CreateFlag)
 
+	j, err := gojail.Create(os.Args[1],
+		gojail.WithHostname(os.Args[2]),
+		gojail.WithPath(os.Args[3]),
+		gojail.Persist(),
+		gojail.Securelevel(secureint),
+		gojail.WithIPv4(os.Args[5]))
 	if err != nil {
-		if je, ok := err.(*gojail.JailErr); ok {
-			fmt.Fprintln(os.Stderr, "gojail: errmsg:", je)
-		} else if sce, ok := err.(*os.SyscallError); ok {
-			fmt.Fprintln(os.Stderr, "gojail: syscall:", sce)
-		} else {
-			fmt.Fprintln(os.Stderr, "gojail:", err)
-		}
+		fmt.Fprintln(os.Stderr, "gojail:", err)
 		os.Exit(1)
 	}
-	fmt.Printf("Created Jail with ID: %d\n", jid)
+	fmt.Printf("Created Jail with ID: %d\n", j.JID())
 
 }
 
@@ -46,13 +46,7 @@ func main() {
 	err = gojail.Remove(jid)
 
 	if err != nil {
-		if je, ok := err.(*gojail.JailErr); ok {
-			fmt.Fprintln(os.Stderr, "gojail: errmsg:", je)
-		} else if sce, ok := err.(*os.SyscallError); ok {
-			fmt.Fprintln(os.Stderr, "gojail: syscall:", sce)
-		} else {
-			fmt.Fprintln(os.Stderr, "gojail:", err)
-		}
+		fmt.Fprintln(os.Stderr, "gojail:", err)
 		os.Exit(1)
 	}
 	fmt.Printf("Removed jail with ID: %d\n", jid)
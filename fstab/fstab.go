@@ -0,0 +1,309 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package fstab reads and writes fstab(5) files, as used by the
+// mount.fstab parameter of jail.conf(5), and single fstab entries like in
+// the mount parameter.
+//
+// Parse keeps comments and blank lines, so a file can be changed and
+// written back with Print.
+package fstab // import "purplekraken.com/pkg/gojail/fstab"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Error is an error in a line of an fstab file.
+type Error struct {
+	Filename string
+	Line     int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.Filename, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Entry is a file system described by an fstab line.
+// The fields are unescaped.
+type Entry struct {
+	Source  string   // fs_spec, the device or directory to mount
+	Target  string   // fs_file, the mount point
+	Type    string   // fs_vfstype, the type of the file system
+	Options []string // fs_mntops, like "ro" or "size=1g"
+	Dump    int      // fs_freq, used by dump(8)
+	Pass    int      // fs_passno, the order of checks by fsck(8)
+	Line    int      // Line number in the file, 0 if not parsed from one
+}
+
+// Option returns the value of the option called name, and whether the
+// entry has the option.
+// The value of options without a "=", like "ro", is empty.
+func (e *Entry) Option(name string) (string, bool) {
+	for _, opt := range e.Options {
+		key, value := opt, ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			key, value = opt[:i], opt[i+1:]
+		}
+		if key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// String returns the entry as an fstab line, with all six fields and
+// white space escaped.
+func (e *Entry) String() string {
+	opts := "rw"
+	if len(e.Options) > 0 {
+		opts = strings.Join(e.Options, ",")
+	}
+	return strings.Join([]string{
+		Escape(e.Source),
+		Escape(e.Target),
+		Escape(e.Type),
+		Escape(opts),
+		strconv.Itoa(e.Dump),
+		strconv.Itoa(e.Pass),
+	}, "\t")
+}
+
+// Line is a line of an fstab file: an entry, a comment or a blank line.
+type Line struct {
+	Entry *Entry
+	// Comment including the "#", for entries a comment following the
+	// fields. Empty for blank lines.
+	Comment string
+}
+
+// File is an fstab file.
+type File struct {
+	Filename string
+	Lines    []Line
+}
+
+// Entries returns the entries of the file.
+func (f *File) Entries() []*Entry {
+	var entries []*Entry
+	for _, l := range f.Lines {
+		if l.Entry != nil {
+			entries = append(entries, l.Entry)
+		}
+	}
+	return entries
+}
+
+// Parse parses the fstab file in src, filename is used in errors only.
+func Parse(filename string, src []byte) (*File, error) {
+	f := &File{Filename: filename}
+	text := string(src)
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return f, nil
+	}
+	for n, s := range strings.Split(text, "\n") {
+		l, err := parseLine(s)
+		if err != nil {
+			return nil, &Error{Filename: filename, Line: n + 1, Err: err}
+		}
+		if l.Entry != nil {
+			l.Entry.Line = n + 1
+		}
+		f.Lines = append(f.Lines, l)
+	}
+	return f, nil
+}
+
+// ParseFile reads and parses the fstab file path.
+func ParseFile(path string) (*File, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, src)
+}
+
+// ParseEntry parses a single fstab entry, like the values of the mount
+// parameter of jail.conf(5). A trailing comment is ignored.
+func ParseEntry(s string) (*Entry, error) {
+	l, err := parseLine(s)
+	if err != nil {
+		return nil, err
+	}
+	if l.Entry == nil {
+		return nil, errors.New("missing fstab entry")
+	}
+	return l.Entry, nil
+}
+
+func parseLine(s string) (Line, error) {
+	s = strings.TrimRight(s, " \t\r")
+	trimmed := strings.TrimLeft(s, " \t")
+	if trimmed == "" || trimmed[0] == '#' {
+		return Line{Comment: trimmed}, nil
+	}
+	var l Line
+	var fields []string
+	for i := 0; i < len(s); {
+		if isSpace(s[i]) {
+			i++
+			continue
+		}
+		if s[i] == '#' {
+			l.Comment = s[i:]
+			break
+		}
+		start := i
+		for i < len(s) && !isSpace(s[i]) {
+			i++
+		}
+		fields = append(fields, s[start:i])
+	}
+	if len(fields) < 3 {
+		return Line{}, fmt.Errorf("expected at least 3 fields, got %d", len(fields))
+	}
+	if len(fields) > 6 {
+		return Line{}, fmt.Errorf("expected at most 6 fields, got %d", len(fields))
+	}
+	for i, field := range fields {
+		u, err := Unescape(field)
+		if err != nil {
+			return Line{}, err
+		}
+		fields[i] = u
+	}
+	e := &Entry{Source: fields[0], Target: fields[1], Type: fields[2]}
+	if len(fields) > 3 {
+		for _, opt := range strings.Split(fields[3], ",") {
+			if opt != "" {
+				e.Options = append(e.Options, opt)
+			}
+		}
+	}
+	for i, p := range []*int{&e.Dump, &e.Pass} {
+		if len(fields) <= 4+i {
+			break
+		}
+		n, err := strconv.Atoi(fields[4+i])
+		if err != nil || n < 0 {
+			return Line{}, fmt.Errorf("invalid number %q", fields[4+i])
+		}
+		*p = n
+	}
+	l.Entry = e
+	return l, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// Unescape replaces octal escapes like "\040" in s by the characters they
+// stand for, as well as "\\" by a single backslash.
+func Unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '\\' {
+			b.WriteByte('\\')
+			i++
+			continue
+		}
+		if i+4 > len(s) {
+			return "", fmt.Errorf("invalid escape in %q", s)
+		}
+		n, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", s)
+		}
+		b.WriteByte(byte(n))
+		i += 3
+	}
+	return b.String(), nil
+}
+
+// Escape replaces white space, "#" and backslashes in s by octal escapes,
+// so it can be used as an fstab field.
+func Escape(s string) string {
+	if !strings.ContainsAny(s, " \t\n#\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n', '#', '\\':
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Fprint writes the file to w, with entries as formatted by
+// Entry.String.
+func Fprint(w io.Writer, f *File) error {
+	for _, l := range f.Lines {
+		var s string
+		switch {
+		case l.Entry != nil && l.Comment != "":
+			s = l.Entry.String() + "\t" + l.Comment
+		case l.Entry != nil:
+			s = l.Entry.String()
+		default:
+			s = l.Comment
+		}
+		if _, err := io.WriteString(w, s+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Print returns the file in fstab format.
+func Print(f *File) []byte {
+	var buf bytes.Buffer
+	Fprint(&buf, f)
+	return buf.Bytes()
+}
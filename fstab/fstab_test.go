@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package fstab_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"purplekraken.com/pkg/gojail/fstab"
+)
+
+const testFstab = `# Device	Mountpoint	FStype	Options	Dump	Pass#
+/dev/ada0p2	/	ufs	rw	1	1
+
+/data/my\040files	/jails/www/srv/my\040files	nullfs	ro,late	0	0 # shared
+tmpfs	/jails/www/tmp	tmpfs	rw,size=1g,mode=1777
+`
+
+func TestParse(t *testing.T) {
+	f, err := fstab.Parse("fstab", []byte(testFstab))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Lines) != 5 {
+		t.Fatalf("got %d lines, want 5", len(f.Lines))
+	}
+	if c := f.Lines[0].Comment; !strings.HasPrefix(c, "# Device") {
+		t.Errorf("comment: got %q", c)
+	}
+	if l := f.Lines[2]; l.Entry != nil || l.Comment != "" {
+		t.Errorf("blank line: got %+v", l)
+	}
+	if c := f.Lines[3].Comment; c != "# shared" {
+		t.Errorf("trailing comment: got %q", c)
+	}
+
+	entries := f.Entries()
+	want := []*fstab.Entry{
+		{Source: "/dev/ada0p2", Target: "/", Type: "ufs", Options: []string{"rw"}, Dump: 1, Pass: 1, Line: 2},
+		{Source: "/data/my files", Target: "/jails/www/srv/my files", Type: "nullfs", Options: []string{"ro", "late"}, Line: 4},
+		{Source: "tmpfs", Target: "/jails/www/tmp", Type: "tmpfs", Options: []string{"rw", "size=1g", "mode=1777"}, Line: 5},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		for i, e := range entries {
+			t.Logf("entry %d: %+v", i, *e)
+		}
+		t.Fatal("unexpected entries")
+	}
+
+	if v, ok := entries[2].Option("size"); !ok || v != "1g" {
+		t.Errorf("Option(size): got %q, %v", v, ok)
+	}
+	if v, ok := entries[1].Option("ro"); !ok || v != "" {
+		t.Errorf("Option(ro): got %q, %v", v, ok)
+	}
+	if _, ok := entries[1].Option("rw"); ok {
+		t.Error("Option(rw): unexpected option")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{"/dev/ada0p2 /", 1},
+		{"# root\n/dev/ada0p2 / ufs rw 1 1 extra", 2},
+		{"/dev/ada0p2 / ufs rw x", 1},
+		{"/dev/ada0p2 / ufs rw 1 -1", 1},
+		{"\n\n/my\\04 /mnt nullfs", 3},
+	}
+	for _, tt := range tests {
+		_, err := fstab.Parse("fstab", []byte(tt.src))
+		var fe *fstab.Error
+		if !errors.As(err, &fe) {
+			t.Errorf("%q: got error %v, want *fstab.Error", tt.src, err)
+			continue
+		}
+		if fe.Filename != "fstab" || fe.Line != tt.line {
+			t.Errorf("%q: got %s:%d, want fstab:%d", tt.src, fe.Filename, fe.Line, tt.line)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	f, err := fstab.Parse("fstab", []byte(testFstab))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := fstab.Print(f)
+	g, err := fstab.Parse("fstab", out)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(f, g) {
+		t.Errorf("round trip changed the file:\n%s", out)
+	}
+	if !strings.Contains(string(out), "/data/my\\040files\t") {
+		t.Errorf("source not escaped:\n%s", out)
+	}
+	if e := (&fstab.Entry{Source: "proc", Target: "/proc", Type: "procfs"}); e.String() != "proc\t/proc\tprocfs\trw\t0\t0" {
+		t.Errorf("String: got %q", e.String())
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, s := range []string{"", "/mnt", "/my files", "a\tb", `back\slash`, "#1"} {
+		e := fstab.Escape(s)
+		if strings.ContainsAny(e, " \t#") {
+			t.Errorf("Escape(%q) = %q", s, e)
+		}
+		u, err := fstab.Unescape(e)
+		if err != nil || u != s {
+			t.Errorf("Unescape(%q) = %q, %v, want %q", e, u, err, s)
+		}
+	}
+	if u, err := fstab.Unescape(`a\\b`); err != nil || u != `a\b` {
+		t.Errorf(`Unescape(a\\b) = %q, %v`, u, err)
+	}
+	for _, s := range []string{`\`, `\04`, `\09x`, `\400`} {
+		if _, err := fstab.Unescape(s); err == nil {
+			t.Errorf("Unescape(%q): expected error", s)
+		}
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	e, err := fstab.ParseEntry(`/data /jails/www/my\040data nullfs ro # comment`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &fstab.Entry{Source: "/data", Target: "/jails/www/my data", Type: "nullfs", Options: []string{"ro"}}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("got %+v, want %+v", *e, *want)
+	}
+	if _, err := fstab.ParseEntry("# comment"); err == nil {
+		t.Error("expected error for a comment")
+	}
+}
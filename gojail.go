@@ -27,19 +27,23 @@
 package gojail // import "purplekraken.com/pkg/gojail"
 
 import (
-	"fmt"
+	"bytes"
+	"errors"
+	"math"
 	"net"
-	"os"
 	"strconv"
+	"strings"
 	sys "syscall"
 
 	"golang.org/x/sys/unix"
+	"purplekraken.com/pkg/gojail/internal/endian"
 	"purplekraken.com/pkg/gojail/syscall"
 )
 
 const (
 	errmsglen  = 1024
-	maxnamelen = 256 // MAXHOSTNAMELEN on FreeBSD, defined in include/sys/param.h
+	maxnamelen = 256  // MAXHOSTNAMELEN on FreeBSD, defined in include/sys/param.h
+	maxpathlen = 1024 // MAXPATHLEN on FreeBSD, defined in include/sys/param.h
 )
 
 type Flags int
@@ -51,14 +55,44 @@ const (
 	AllowDyingFlag Flags = syscall.JAIL_DYING
 )
 
+// Type of a parameter value, following the kernel types of jailparam(3).
 type ParamType int
 
 const (
-	String ParamType = 0
-	Int    ParamType = 1
-	Raw    ParamType = 2
+	String  ParamType = 0  // NUL-terminated string
+	Int     ParamType = 1  // int
+	Raw     ParamType = 2  // Opaque structure
+	Uint    ParamType = 3  // unsigned int
+	Long    ParamType = 4  // long
+	Ulong   ParamType = 5  // unsigned long
+	Bool    ParamType = 6  // Boolean, stored as int
+	NoBool  ParamType = 7  // Negated boolean, like "nopersist"
+	JailSys ParamType = 8  // One of "disable", "new" and "inherit", stored as int
+	IP4     ParamType = 9  // Array of struct in_addr
+	IP6     ParamType = 10 // Array of struct in6_addr
 )
 
+var paramTypeNames = [...]string{
+	String:  "string",
+	Int:     "int",
+	Raw:     "struct",
+	Uint:    "uint",
+	Long:    "long",
+	Ulong:   "ulong",
+	Bool:    "bool",
+	NoBool:  "nobool",
+	JailSys: "jailsys",
+	IP4:     "ip4",
+	IP6:     "ip6",
+}
+
+func (t ParamType) String() string {
+	if t >= 0 && int(t) < len(paramTypeNames) {
+		return paramTypeNames[t]
+	}
+	return "ParamType(" + strconv.Itoa(int(t)) + ")"
+}
+
 type JailParam interface {
 	Name() []byte
 	Data() []byte
@@ -83,7 +117,26 @@ func (jp jailParam) Type() ParamType {
 	return jp.ptype
 }
 
+// NewStringParam returns a parameter with a string value.
+// If the parameter is known to the default registry, it must be a string
+// parameter and the value must fit, or a boolean, in which case value must
+// be empty and the parameter is set, like "persist;" in jail.conf(5).
 func NewStringParam(name, value string) (JailParam, error) {
+	if info, ok := LookupParam(name); ok {
+		switch info.Type {
+		case String:
+			if info.Size > 0 && len(value) >= info.Size {
+				return nil, invalidParamError("value of parameter %s is longer than %d bytes", name, info.Size-1)
+			}
+		case Bool, NoBool:
+			if value != "" {
+				return nil, invalidParamError("boolean parameter %s does not take a value", name)
+			}
+			return newBoolParam(info, true)
+		default:
+			return nil, wrongTypeError(name, info.Type, String)
+		}
+	}
 	nameb, err := unix.ByteSliceFromString(name)
 	if err != nil {
 		return nil, err
@@ -99,63 +152,240 @@ func NewStringParam(name, value string) (JailParam, error) {
 	}, nil
 }
 
+// NewIntParam returns a parameter with an integer value.
+// If the parameter is known to the default registry, it must be of type
+// Int, Uint, Bool or JailSys and the value must be in its range.
 func NewIntParam(name string, value int) (JailParam, error) {
+	ptype := Int
+	if info, ok := LookupParam(name); ok {
+		switch info.Type {
+		case Int:
+			if value < math.MinInt32 || value > math.MaxInt32 {
+				return nil, invalidParamError("value of parameter %s is out of range: %d", name, value)
+			}
+		case Uint:
+			if value < 0 || uint64(value) > math.MaxUint32 {
+				return nil, invalidParamError("value of parameter %s is out of range: %d", name, value)
+			}
+		case Bool, NoBool:
+			if value != 0 && value != 1 {
+				return nil, invalidParamError("value of boolean parameter %s must be 0 or 1: %d", name, value)
+			}
+			return newBoolParam(info, value == 1)
+		case JailSys:
+			if value < jailSysDisable || value > jailSysInherit {
+				return nil, invalidParamError("value of jailsys parameter %s is out of range: %d", name, value)
+			}
+		default:
+			return nil, wrongTypeError(name, info.Type, Int)
+		}
+		ptype = info.Type
+	}
 	nameb, err := unix.ByteSliceFromString(name)
 	if err != nil {
 		return nil, err
 	}
-	buf := make([]byte, 4)
-	hostByteOrder.PutUint32(buf, uint32(value))
 	return jailParam{
 		name:  nameb,
-		data:  buf,
-		ptype: Int,
+		data:  intToBytes(value),
+		ptype: ptype,
+	}, nil
+}
+
+// NewLongParam returns a parameter with a value of type long, which is as
+// wide as a pointer.
+// If the parameter is known to the default registry, it must be of type
+// Long.
+func NewLongParam(name string, value int64) (JailParam, error) {
+	if endian.LongSize == 4 && (value < math.MinInt32 || value > math.MaxInt32) {
+		return nil, invalidParamError("value of parameter %s is out of range: %d", name, value)
+	}
+	return newLongParam(name, Long, uint64(value))
+}
+
+// NewUlongParam returns a parameter with a value of type unsigned long,
+// which is as wide as a pointer.
+// If the parameter is known to the default registry, it must be of type
+// Ulong.
+func NewUlongParam(name string, value uint64) (JailParam, error) {
+	if endian.LongSize == 4 && value > math.MaxUint32 {
+		return nil, invalidParamError("value of parameter %s is out of range: %d", name, value)
+	}
+	return newLongParam(name, Ulong, value)
+}
+
+func newLongParam(name string, ptype ParamType, value uint64) (JailParam, error) {
+	if info, ok := LookupParam(name); ok && info.Type != ptype {
+		return nil, wrongTypeError(name, info.Type, ptype)
+	}
+	nameb, err := unix.ByteSliceFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	return jailParam{
+		name:  nameb,
+		data:  longToBytes(value),
+		ptype: ptype,
+	}, nil
+}
+
+// Values of jailsys parameters, defined in sys/jail.h.
+const (
+	jailSysDisable = 0
+	jailSysNew     = 1
+	jailSysInherit = 2
+)
+
+// Returns a boolean parameter for the parameter described by info.
+// Booleans are stored as int under the name of the underlying parameter,
+// NoBool parameters are negated.
+func newBoolParam(info ParamInfo, value bool) (JailParam, error) {
+	if info.Type == NoBool {
+		value = !value
+	}
+	nameb, err := unix.ByteSliceFromString(info.Name)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	if value {
+		i = 1
+	}
+	return jailParam{
+		name:  nameb,
+		data:  intToBytes(i),
+		ptype: Bool,
 	}, nil
 }
 
-// TODO: The IP must be added to some interface
-// otherwise is just an IP :)
-// inet 192.168.0.222 netmask 0xffffffff broadcast 192.168.0.222
+func wrongTypeError(name string, have, want ParamType) error {
+	return invalidParamError("parameter %s is of type %s, not %s", name, have, want)
+}
+
+// NewIPParam returns an ip4.addr or ip6.addr parameter holding the address
+// value.
+// The jail can only use the address if it is assigned to an interface of
+// the host, the network package adds it as an alias.
 func NewIPParam(value string) (JailParam, error) {
 	ip := net.ParseIP(value)
 	if ip == nil {
-		return nil, fmt.Errorf("Invalid IP address provided")
+		return nil, invalidParamError("Invalid IP address provided")
 	}
 
 	var nameb []byte
 	var buf []byte
+	var ptype ParamType
 	if ip4 := ip.To4(); ip4 != nil {
 		nameb = byteSliceFromStringOrDie("ip4.addr")
 		buf = ip4
+		ptype = IP4
 	} else {
 		nameb = byteSliceFromStringOrDie("ip6.addr")
 		buf = ip
+		ptype = IP6
 	}
 
 	return jailParam{
 		name:  nameb,
 		data:  buf,
-		ptype: Raw,
+		ptype: ptype,
 	}, nil
 }
 
-// Error message from the jail subsystem.
-// Represents an error returned as the "errmsg" parameter from JailGet or JailSet.
-type JailErr struct {
-	errmsg string
+// NewIPListParam returns an ip4.addr or ip6.addr parameter holding all
+// addresses in addrs, which must be of the same family.
+func NewIPListParam(addrs ...string) (JailParam, error) {
+	if len(addrs) == 0 {
+		return nil, invalidParamError("no IP addresses provided")
+	}
+	ptype := IP4
+	if strings.Contains(addrs[0], ":") {
+		ptype = IP6
+	}
+	data := make([]byte, 0, len(addrs)*net.IPv6len)
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, invalidParamError("invalid IP address %s", addr)
+		}
+		if (ptype == IP6) != strings.Contains(addr, ":") {
+			return nil, invalidParamError("cannot mix IPv4 and IPv6 addresses: %s", strings.Join(addrs, ", "))
+		}
+		if ptype == IP4 {
+			data = append(data, ip.To4()...)
+		} else {
+			data = append(data, ip.To16()...)
+		}
+	}
+	return jailParam{
+		name:  byteSliceFromStringOrDie(ipFamily(ptype) + ".addr"),
+		data:  data,
+		ptype: ptype,
+	}, nil
 }
 
-func (je *JailErr) Error() string {
-	return je.errmsg
+// IPMode is the value of the ip4 and ip6 parameters, controlling the
+// access of a jail to the addresses of a family.
+type IPMode int
+
+const (
+	// The jail cannot use addresses of the family.
+	IPDisable IPMode = jailSysDisable
+	// The jail is restricted to the addresses in ip4.addr or ip6.addr.
+	IPNew IPMode = jailSysNew
+	// The jail can use all addresses of its parent.
+	IPInherit IPMode = jailSysInherit
+)
+
+// Returns the parameter prefix of the address family ptype, which is IP4
+// or IP6.
+func ipFamily(ptype ParamType) string {
+	if ptype == IP6 {
+		return "ip6"
+	}
+	return "ip4"
+}
+
+func checkIPFamily(family ParamType) error {
+	if family != IP4 && family != IP6 {
+		return invalidParamError("%s is not an address family", family)
+	}
+	return nil
 }
 
-// Error returned by GetId and GetName if the specified jail does not exist.
-var NoJail error = &JailErr{errmsg: "No such jail"}
+// NewIPModeParam returns the ip4 or ip6 parameter, for family IP4 or IP6.
+func NewIPModeParam(family ParamType, mode IPMode) (JailParam, error) {
+	if err := checkIPFamily(family); err != nil {
+		return nil, err
+	}
+	return NewIntParam(ipFamily(family), int(mode))
+}
+
+// NewSaddrselParam returns the ip4.saddrsel or ip6.saddrsel parameter, for
+// family IP4 or IP6, which controls source address selection for unbound
+// sockets in the jail.
+func NewSaddrselParam(family ParamType, enable bool) (JailParam, error) {
+	if err := checkIPFamily(family); err != nil {
+		return nil, err
+	}
+	return newBoolParam(ParamInfo{Name: ipFamily(family) + ".saddrsel", Type: Bool}, enable)
+}
 
-func makeJailErr(errmsg []byte) error {
-	return &JailErr{
-		errmsg: string(errmsg),
+// NewVnetParam returns the vnet parameter, which gives the jail a virtual
+// network stack of its own if newStack is set, and makes it share the one
+// of its parent otherwise.
+// The network interfaces of a jail with its own stack are set up with the
+// network package.
+func NewVnetParam(newStack bool) (JailParam, error) {
+	mode := jailSysInherit
+	if newStack {
+		mode = jailSysNew
 	}
+	return jailParam{
+		name:  byteSliceFromStringOrDie("vnet"),
+		data:  intToBytes(mode),
+		ptype: JailSys,
+	}, nil
 }
 
 func byteSliceFromStringOrDie(s string) []byte {
@@ -166,26 +396,44 @@ func byteSliceFromStringOrDie(s string) []byte {
 	return b
 }
 
+var hostByteOrder = endian.Native
+
 func intToBytes(i int) []byte {
 	b := make([]byte, 4)
 	hostByteOrder.PutUint32(b, uint32(i))
 	return b
 }
 
-// Converts errno to an instance of os.SyscallError using errno if retval is
-// not zero.
-func asSyscallError(name string, err error) error {
-	if err != nil {
-		if errno, ok := err.(sys.Errno); ok {
-			err = os.NewSyscallError(name, errno)
-		}
+func bytesToInt(b []byte) int {
+	return int(int32(hostByteOrder.Uint32(b)))
+}
+
+// Encodes u in the width of a C long.
+func longToBytes(u uint64) []byte {
+	b := make([]byte, endian.LongSize)
+	endian.PutLong(b, u)
+	return b
+}
+
+// Decodes a C long, sign-extending it on 32-bit platforms.
+func bytesToLong(b []byte) int64 {
+	if endian.LongSize == 4 {
+		return int64(int32(hostByteOrder.Uint32(b)))
 	}
-	return err
+	return int64(hostByteOrder.Uint64(b))
+}
+
+// Returns the string up to the first NUL byte in b.
+func cstring(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = b[:n]
+	}
+	return string(b)
 }
 
 // Returns the JID of the jail identified by name, -1 if it doesn't exist.
 func GetId(name string) (int, error) {
-	var iov [4][]byte
+	var iov [2][]byte
 	if jid, err := strconv.Atoi(name); err == nil {
 		if jid == 0 {
 			return jid, nil
@@ -199,69 +447,79 @@ func GetId(name string) (int, error) {
 			return -1, err
 		}
 	}
-	iov[2] = byteSliceFromStringOrDie("errmsg")
-	iov[3] = make([]byte, errmsglen)
-	jid, err := syscall.JailGet(iov[:], 0)
-	if err != nil {
-		// The jail does not exist, but that is not really an error.
-		// Checking the kind of error is tedious for the users, so
-		// differentiate here.
-		// Attention: jail_get(2) returns ENOENT on three occasions:
-		// 1. The jail referred to by a jid or name parameter does
-		//    not exist.
-		// 2. The jail referred to by a jid is not accessible by the
-		//    process, because the process is in a different jail.
-		// 3. The lastjid parameter is greater than the highest
-		//    current jail ID.
-		// We don't care for the second case, because the situation
-		// is equivalent to the first case, for processes in a jail
-		// other jails do not exist, but we need to be careful with
-		// the third case.
-		// In this function, there is no "lastjid" parameter, so
-		// everything is fine, but this is not the general case.
-		if syserr, ok := err.(sys.Errno); ok && syserr == sys.ENOENT {
-			err = NoJail
-		} else {
-			err = asSyscallError("jail_get", err)
-		}
-	} else if jid == -1 && iov[3][0] != 0 {
-		err = makeJailErr(iov[3])
+	jid, err := callWithErrmsg("jail_get", iov[:], 0, func(iov [][]byte) (int, error) {
+		return backend.JailGet(iov, 0)
+	})
+	// The jail does not exist, but that is not really an error.
+	// Checking the kind of error is tedious for the users, so
+	// differentiate here.
+	// Attention: jail_get(2) returns ENOENT on three occasions:
+	// 1. The jail referred to by a jid or name parameter does
+	//    not exist.
+	// 2. The jail referred to by a jid is not accessible by the
+	//    process, because the process is in a different jail.
+	// 3. The lastjid parameter is greater than the highest
+	//    current jail ID.
+	// We don't care for the second case, because the situation
+	// is equivalent to the first case, for processes in a jail
+	// other jails do not exist, but we need to be careful with
+	// the third case.
+	// In this function, there is no "lastjid" parameter, so
+	// everything is fine, but this is not the general case.
+	if errors.Is(err, ErrNotFound) {
+		err = NoJail
 	}
 	return jid, err
 }
 
 // Returns the name of the jail identified by jid.
 func GetName(jid int) (string, error) {
-	var iov [6][]byte
+	name, err := StringOut("name")
+	if err != nil {
+		return "", err
+	}
+	var iov [4][]byte
 	iov[0] = byteSliceFromStringOrDie("jid")
 	iov[1] = intToBytes(jid)
-	iov[2] = byteSliceFromStringOrDie("name")
-	iov[3] = make([]byte, maxnamelen)
-	iov[4] = byteSliceFromStringOrDie("errmsg")
-	iov[5] = make([]byte, errmsglen)
-	jid, err := syscall.JailGet(iov[:], 0)
+	iov[2] = name.Name()
+	iov[3] = name.buffer()
+	_, err = callWithErrmsg("jail_get", iov[:], 0, func(iov [][]byte) (int, error) {
+		return backend.JailGet(iov, 0)
+	})
 	if err != nil {
-		if syserr, ok := err.(sys.Errno); ok && syserr == sys.ENOENT {
+		if errors.Is(err, ErrNotFound) {
 			err = NoJail
-		} else {
-			err = asSyscallError("jail_get", err)
 		}
-	} else if jid == -1 && iov[5][0] != 00 {
-		err = makeJailErr(iov[5])
+		return "", err
 	}
-	return string(iov[3]), err
+	name.setData(iov[3])
+	return name.Value(), nil
 }
 
 // Attach the current process to the jail identified by jid.
 // See jail_attach(2) for further information.
+// This affects all threads of the process, use Command to run a program in
+// a jail instead.
 func Attach(jid int) error {
-	return asSyscallError("jail_attach", syscall.JailAttach(jid))
+	return syscallError("jail_attach", backend.JailAttach(jid))
 }
 
 // Remove the jail idenified by jid.
 // See jail_remove(2) for further information.
-func Remove(jid int) error {
-	return asSyscallError("jail_remove", syscall.JailRemove(jid))
+// The jail may linger in the dying state after Remove returns, unless the
+// WaitUntilGone option is given.
+func Remove(jid int, opts ...RemoveOption) error {
+	var o removeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := backend.JailRemove(jid); err != nil {
+		return syscallError("jail_remove", err)
+	}
+	if o.wait != nil {
+		return WaitGone(o.wait, jid)
+	}
+	return nil
 }
 
 func paramsToBytes(ps []JailParam) [][]byte {
@@ -274,14 +532,165 @@ func paramsToBytes(ps []JailParam) [][]byte {
 	return bs
 }
 
+// Like paramsToBytes, but booleans are passed the way jail_set(2) expects
+// them: by their name if they are set, by their name with a "no" prefix
+// otherwise, and without a value in both cases.
+func setParamsToBytes(ps []JailParam) [][]byte {
+	bs := paramsToBytes(ps)
+	for pi, p := range ps {
+		if p.Type() != Bool || len(p.Data()) != 4 {
+			continue
+		}
+		bi := pi * 2
+		if bytesToInt(p.Data()) == 0 {
+			bs[bi] = byteSliceFromStringOrDie(addNo(cstring(p.Name())))
+		}
+		bs[bi+1] = nil
+	}
+	return bs
+}
+
+// Calls the jail_set(2) or jail_get(2) function fn with the parameters in
+// iov and an "errmsg" parameter, unless iov already contains one.
+// Errors are returned as *JailErr, with the message from the jail subsystem
+// if there is one. If the request was made without AllowDyingFlag in flags
+// and did not find the jail, the error matches ErrDying if the jail is
+// dying.
+func callWithErrmsg(op string, iov [][]byte, flags Flags, fn func([][]byte) (int, error)) (int, error) {
+	var errmsg []byte
+	for i := 0; i+1 < len(iov); i += 2 {
+		if cstring(iov[i]) == "errmsg" {
+			errmsg = iov[i+1]
+			break
+		}
+	}
+	req := iov
+	if errmsg == nil {
+		errmsg = make([]byte, errmsglen)
+		req = append(iov[:len(iov):len(iov)], byteSliceFromStringOrDie("errmsg"), errmsg)
+	}
+	jid, err := fn(req)
+	// Pass on the value lengths reported by jail_get(2).
+	copy(iov, req)
+	if err == nil {
+		return jid, nil
+	}
+	if errno, ok := err.(sys.Errno); ok && len(errmsg) > 0 && errmsg[0] != 0 {
+		err = newJailErr(op, errno, cstring(errmsg))
+	} else {
+		err = syscallError(op, err)
+	}
+	if je, ok := err.(*JailErr); ok && je.Errno == sys.ENOENT && flags&AllowDyingFlag == 0 && isDying(iov) {
+		je.dying = true
+	}
+	return jid, err
+}
+
+// Reports whether the jail identified by the jid or name parameter in iov
+// is dying, by looking it up again with AllowDyingFlag.
+// Requests with the lastjid parameter do not identify a jail.
+func isDying(iov [][]byte) bool {
+	var key, value []byte
+	for i := 0; i+1 < len(iov); i += 2 {
+		switch cstring(iov[i]) {
+		case "lastjid":
+			return false
+		case "jid":
+			if len(iov[i+1]) == 4 && bytesToInt(iov[i+1]) != 0 {
+				key, value = iov[i], iov[i+1]
+			}
+		case "name":
+			if key == nil && cstring(iov[i+1]) != "" {
+				key, value = iov[i], iov[i+1]
+			}
+		}
+	}
+	if key == nil {
+		return false
+	}
+	dying := make([]byte, 4)
+	req := [][]byte{key, value, byteSliceFromStringOrDie("dying"), dying}
+	if _, err := backend.JailGet(req, AllowDyingFlag); err != nil {
+		return false
+	}
+	return bytesToInt(req[3]) != 0
+}
+
+// SetParams creates or updates a jail, like jail_set(2).
+// If the kernel rejects the request, the error is a *JailErr with its
+// explanation.
 func SetParams(params []JailParam, flags Flags) (int, error) {
-	p := paramsToBytes(params)
-	jid, err := syscall.JailSet(p, int(flags))
-	return jid, asSyscallError("jail_set", err)
+	p := setParamsToBytes(params)
+	return callWithErrmsg("jail_set", p, flags, func(iov [][]byte) (int, error) {
+		return backend.JailSet(iov, flags)
+	})
 }
 
+// Like paramsToBytes, but output parameters pass their buffers.
+func getParamsToBytes(ps []JailParam) [][]byte {
+	bs := paramsToBytes(ps)
+	for pi, p := range ps {
+		if op, ok := p.(outputParam); ok {
+			bs[pi*2+1] = op.buffer()
+		}
+	}
+	return bs
+}
+
+// Like jailparam_get(3), the buffers for arrays get room for arraySlop
+// elements more than the kernel reported, and GetParams tries again up to
+// arraySanity times if an array grew beyond that in the meantime.
+const (
+	arraySlop   = 5
+	arraySanity = 5
+)
+
+// GetParams reads the parameters of a jail, identified by one of the
+// parameters "jid", "name" or "lastjid", like jail_get(2).
+// Output parameters, like the ones returned by Want, receive the values
+// reported by the kernel. For arrays like ip4.addr, the current length is
+// asked for first.
+// Errors are reported like by SetParams.
 func GetParams(params []JailParam, flags Flags) (int, error) {
-	p := paramsToBytes(params)
-	jid, err := syscall.JailGet(p, int(flags))
-	return jid, asSyscallError("jail_get", err)
+	p := getParamsToBytes(params)
+	get := func() (int, error) {
+		return callWithErrmsg("jail_get", p, flags, func(iov [][]byte) (int, error) {
+			return backend.JailGet(iov, flags)
+		})
+	}
+	var arrays []int
+	for pi, param := range params {
+		if op, ok := param.(outputParam); ok && op.elemSize() > 0 {
+			arrays = append(arrays, pi)
+		}
+	}
+	var jid int
+	var err error
+	for i := 0; ; i++ {
+		if len(arrays) > 0 {
+			// Empty values ask for their length.
+			for _, pi := range arrays {
+				p[pi*2+1] = nil
+			}
+			if jid, err = get(); err != nil {
+				return jid, err
+			}
+			for _, pi := range arrays {
+				size := params[pi].(outputParam).elemSize()
+				p[pi*2+1] = make([]byte, len(p[pi*2+1])+arraySlop*size)
+			}
+		}
+		jid, err = get()
+		if len(arrays) == 0 || i == arraySanity || !errors.Is(err, ErrInvalidParam) {
+			break
+		}
+	}
+	if err == nil {
+		for pi, param := range params {
+			if op, ok := param.(outputParam); ok {
+				op.setData(p[pi*2+1])
+			}
+		}
+	}
+	return jid, err
 }
@@ -0,0 +1,1152 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/jailtest"
+)
+
+func useFakeKernel(t *testing.T) *jailtest.Kernel {
+	k := jailtest.NewKernel()
+	prev := gojail.SetBackend(k)
+	t.Cleanup(func() { gojail.SetBackend(prev) })
+	return k
+}
+
+func TestLifecycle(t *testing.T) {
+	useFakeKernel(t)
+	var params []gojail.JailParam
+	for _, kv := range [][2]string{{"name", "foo"}, {"persist", ""}} {
+		p, err := gojail.NewStringParam(kv[0], kv[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		params = append(params, p)
+	}
+	securelevel, err := gojail.NewIntParam("securelevel", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params = append(params, securelevel)
+	jid, err := gojail.SetParams(params, gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if id, err := gojail.GetId("foo"); err != nil || id != jid {
+		t.Errorf("GetId: got %d, %v, expected %d", id, err, jid)
+	}
+	if name, err := gojail.GetName(jid); err != nil || name != "foo" {
+		t.Errorf("GetName: got %q, %v", name, err)
+	}
+	if err := gojail.Remove(jid); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := gojail.GetId("foo"); err != gojail.NoJail {
+		t.Errorf("expected NoJail, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	k := useFakeKernel(t)
+	var jids []int
+	for _, name := range []string{"a", "b", "c"} {
+		p, err := gojail.NewStringParam("name", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		persist, err := gojail.NewStringParam("persist", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		jid, err := gojail.SetParams([]gojail.JailParam{p, persist}, gojail.CreateFlag)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		jids = append(jids, jid)
+	}
+	if err := k.Hold(jids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := gojail.Remove(jids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	jails, err := gojail.List(0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(jails) != 2 || jails[0].Name != "a" || jails[1].Name != "c" {
+		t.Errorf("unexpected jails %+v", jails)
+	}
+	if jails[0].Path != "/" {
+		t.Errorf("unexpected path %q", jails[0].Path)
+	}
+
+	jails, err = gojail.List(gojail.AllowDyingFlag)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(jails) != 3 || !jails[1].Dying || jails[1].JID != jids[1] {
+		t.Errorf("unexpected jails %+v", jails)
+	}
+}
+
+func TestParamTypes(t *testing.T) {
+	if _, err := gojail.NewIntParam("name", 1); err == nil {
+		t.Errorf("expected error for int value of a string parameter")
+	}
+	if _, err := gojail.NewStringParam("securelevel", "3"); err == nil {
+		t.Errorf("expected error for string value of an int parameter")
+	}
+	if _, err := gojail.NewStringParam("persist", "yes"); err == nil {
+		t.Errorf("expected error for boolean with a value")
+	}
+	if _, err := gojail.NewIntParam("vnet", 3); err == nil {
+		t.Errorf("expected error for jailsys value out of range")
+	}
+	if _, err := gojail.NewStringParam("name", strings.Repeat("x", 256)); err == nil {
+		t.Errorf("expected error for overlong name")
+	}
+	if _, err := gojail.NewStringParam("x.unknown", "foo"); err != nil {
+		t.Errorf("unexpected error for unknown parameter: %v", err)
+	}
+
+	p, err := gojail.NewStringParam("allow.noraw_sockets", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type() != gojail.Bool || string(p.Name()) != "allow.raw_sockets\x00" {
+		t.Errorf("unexpected parameter %q of type %v", p.Name(), p.Type())
+	}
+}
+
+func TestBoolParams(t *testing.T) {
+	useFakeKernel(t)
+	var params []gojail.JailParam
+	for _, kv := range [][2]string{{"name", "foo"}, {"persist", ""}, {"allow.noset_hostname", ""}} {
+		p, err := gojail.NewStringParam(kv[0], kv[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		params = append(params, p)
+	}
+	jid, err := gojail.SetParams(params, gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	jidp, err := gojail.NewIntParam("jid", jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, err := gojail.NewIntParam("allow.set_hostname", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gojail.GetParams([]gojail.JailParam{jidp, allow}, 0); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if allow.Data()[0] != 0 {
+		t.Errorf("expected allow.set_hostname to be cleared")
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	tests := []struct {
+		name, text, export string
+	}{
+		{"name", "foo", "foo"},
+		{"securelevel", "-1", "-1"},
+		{"children.max", "10", "10"},
+		{"host.hostid", "18446744073709551615", "18446744073709551615"},
+		{"persist", "", "true"},
+		{"persist", "FALSE", "false"},
+		{"nopersist", "", "false"},
+		{"nopersist", "false", "true"},
+		{"vnet", "new", "new"},
+		{"ip4", "", "new"},
+		{"ip6", "inherit", "inherit"},
+		{"ip4.addr", "192.0.2.1, 192.0.2.2", "192.0.2.1,192.0.2.2"},
+		{"ip4.addr", "", ""},
+		{"ip6.addr", "2001:db8::1,2001:db8::2", "2001:db8::1,2001:db8::2"},
+		{"ip6.addr", "::ffff:192.0.2.1", "::ffff:192.0.2.1"},
+	}
+	for _, test := range tests {
+		p, err := gojail.Import(test.name, test.text)
+		if err != nil {
+			t.Errorf("Import(%q, %q): %v", test.name, test.text, err)
+			continue
+		}
+		text, err := gojail.Export(p)
+		if err != nil || text != test.export {
+			t.Errorf("Export(Import(%q, %q)) = %q, %v, expected %q", test.name, test.text, text, err, test.export)
+			continue
+		}
+		q, err := gojail.Import(strings.TrimRight(string(p.Name()), "\x00"), text)
+		if err != nil || string(q.Name()) != string(p.Name()) || string(q.Data()) != string(p.Data()) || q.Type() != p.Type() {
+			t.Errorf("%s: round trip of %q failed", test.name, text)
+		}
+	}
+
+	for _, bad := range [][2]string{
+		{"securelevel", "high"},
+		{"securelevel", "4294967296"},
+		{"children.max", ""},
+		{"persist", "maybe"},
+		{"vnet", "new,inherit"},
+		{"ip4.addr", "2001:db8::1"},
+		{"ip6.addr", "192.0.2.1"},
+		{"allow.foo", "true"},
+	} {
+		if _, err := gojail.Import(bad[0], bad[1]); err == nil {
+			t.Errorf("Import(%q, %q): expected error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestOutParams(t *testing.T) {
+	useFakeKernel(t)
+	var params []gojail.JailParam
+	for _, kv := range [][2]string{
+		{"name", "foo"},
+		{"persist", ""},
+		{"host.hostname", "foo.example.org"},
+		{"ip4.addr", "192.0.2.1,192.0.2.2"},
+	} {
+		p, err := gojail.Import(kv[0], kv[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		params = append(params, p)
+	}
+	jid, err := gojail.SetParams(params, gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	key, err := gojail.NewIntParam("jid", jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname, err := gojail.StringOut("host.hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	securelevel, err := gojail.IntOut("securelevel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := gojail.IPListOut("ip4.addr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	persist, err := gojail.Want("persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip4, err := gojail.Want("ip4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gojail.GetParams([]gojail.JailParam{key, hostname, securelevel, addrs, persist, ip4}, 0); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if v := hostname.Value(); v != "foo.example.org" {
+		t.Errorf("unexpected hostname %q", v)
+	}
+	if v := securelevel.Value(); v != -1 {
+		t.Errorf("unexpected securelevel %d", v)
+	}
+	if v := addrs.Value(); len(v) != 2 || v[1].String() != "192.0.2.2" {
+		t.Errorf("unexpected addresses %v", v)
+	}
+	if v := persist.Value(); v != true {
+		t.Errorf("unexpected persist %v", v)
+	}
+	if s := ip4.String(); s != "new" {
+		t.Errorf("unexpected ip4 %q", s)
+	}
+
+	if _, err := gojail.StringOut("securelevel"); err == nil {
+		t.Errorf("expected error for mismatched type")
+	}
+	if _, err := gojail.Want("allow.foo"); err == nil {
+		t.Errorf("expected error for unknown parameter")
+	}
+}
+
+func TestErrmsg(t *testing.T) {
+	useFakeKernel(t)
+	name, err := gojail.NewStringParam("name", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	persist, err := gojail.NewStringParam("persist", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := []gojail.JailParam{name, persist}
+	if _, err := gojail.SetParams(params, gojail.CreateFlag); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = gojail.SetParams(params, gojail.CreateFlag)
+	je, ok := err.(*gojail.JailErr)
+	if !ok {
+		t.Fatalf("expected *JailErr, got %T: %v", err, err)
+	}
+	if je.Op != "jail_set" || je.Errno != syscall.EEXIST || je.Message() != `jail "foo" already exists` {
+		t.Errorf("unexpected error %#v", je)
+	}
+
+	hostname, err := gojail.StringOut("host.hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := gojail.NewStringParam("name", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gojail.GetParams([]gojail.JailParam{other, hostname}, 0)
+	if je, ok := err.(*gojail.JailErr); !ok || je.Op != "jail_get" || je.Errno != syscall.ENOENT {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	k := useFakeKernel(t)
+	if _, err := gojail.GetId("foo"); !errors.Is(err, gojail.ErrNotFound) || err != gojail.NoJail {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	name, err := gojail.NewStringParam("name", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	persist, err := gojail.NewStringParam("persist", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := []gojail.JailParam{name, persist}
+	jid, err := gojail.SetParams(params, gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = gojail.SetParams(params, gojail.CreateFlag)
+	if !errors.Is(err, gojail.ErrExists) || !errors.Is(err, syscall.EEXIST) || errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+	var sce *os.SyscallError
+	if !errors.As(err, &sce) || sce.Syscall != "jail_set" {
+		t.Errorf("expected *os.SyscallError in the chain of %v", err)
+	}
+
+	if err := k.Hold(jid); err != nil {
+		t.Fatal(err)
+	}
+	if err := gojail.Remove(jid); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := gojail.Remove(jid); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam, got %v", err)
+	}
+	key, err := gojail.NewIntParam("jid", jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gojail.GetParams([]gojail.JailParam{key}, 0)
+	if !errors.Is(err, gojail.ErrDying) || !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected ErrDying, got %v", err)
+	}
+
+	if _, err := gojail.NewIntParam("name", 1); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam, got %v", err)
+	}
+}
+
+func TestJailHandle(t *testing.T) {
+	useFakeKernel(t)
+	var params []gojail.JailParam
+	for _, kv := range [][2]string{{"name", "foo"}, {"persist", ""}} {
+		p, err := gojail.Import(kv[0], kv[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		params = append(params, p)
+	}
+	j, err := gojail.NewJail(params, gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if j.Name() != "foo" {
+		t.Errorf("unexpected name %q", j.Name())
+	}
+
+	hostname, err := gojail.Import("host.hostname", "foo.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Update(hostname); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	out, err := gojail.StringOut("host.hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Params(out); err != nil || out.Value() != "foo.example.org" {
+		t.Errorf("unexpected hostname %q, %v", out.Value(), err)
+	}
+
+	// Replace the jail by another one with the same JID.
+	jid := j.JID()
+	if err := gojail.Remove(jid); err != nil {
+		t.Fatal(err)
+	}
+	key, err := gojail.NewIntParam("jid", jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params[0], err = gojail.Import("name", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gojail.SetParams(append(params, key), gojail.CreateFlag); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if stale, err := j.Stale(); err != nil || !stale {
+		t.Errorf("expected stale handle, got %v, %v", stale, err)
+	}
+	if err := j.Remove(); !errors.Is(err, gojail.ErrStale) {
+		t.Errorf("expected ErrStale, got %v", err)
+	}
+	if err := j.Params(out); !errors.Is(err, gojail.ErrStale) {
+		t.Errorf("expected ErrStale, got %v", err)
+	}
+	if _, err := gojail.GetId("bar"); err != nil {
+		t.Errorf("jail was removed through stale handle: %v", err)
+	}
+	if err := j.Refresh(); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	bar, err := gojail.Open("bar")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if bar.JID() != jid {
+		t.Errorf("unexpected JID %d", bar.JID())
+	}
+	if err := bar.Remove(); err != nil {
+		t.Errorf("remove: %v", err)
+	}
+}
+
+func TestAddressClash(t *testing.T) {
+	useFakeKernel(t)
+	if _, err := gojail.Create("www", gojail.WithIPv4("192.0.2.1"), gojail.Persist()); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err := gojail.Create("db", gojail.WithIPv4("192.0.2.1"), gojail.Persist())
+	if !errors.Is(err, gojail.ErrExists) || !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("expected ErrExists for the address clash, got %v", err)
+	}
+	_, err = gojail.Ensure("db", gojail.WithIPv4("192.0.2.1"), gojail.Persist())
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("expected Ensure to fail with EADDRINUSE, got %v", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	useFakeKernel(t)
+	j, err := gojail.Create("www",
+		gojail.WithPath("/jails/www"),
+		gojail.WithHostname("www.example.org"),
+		gojail.WithIPv4("192.0.2.1"),
+		gojail.WithIPv4("192.0.2.2"),
+		gojail.Persist(),
+		gojail.Securelevel(2),
+		gojail.Allow("raw_sockets", "mount.devfs"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	addrs, err := gojail.IPListOut("ip4.addr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := gojail.Want("allow.raw_sockets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Params(addrs, raw); err != nil {
+		t.Fatalf("params: %v", err)
+	}
+	if len(addrs.Value()) != 2 || raw.String() != "true" {
+		t.Errorf("unexpected parameters %v, %v", addrs.Value(), raw)
+	}
+
+	if _, err := gojail.Create("www", gojail.Persist()); !errors.Is(err, gojail.ErrExists) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+	if _, err := gojail.Update("www", gojail.WithHostname("web.example.org")); err != nil {
+		t.Errorf("update: %v", err)
+	}
+
+	if _, err := gojail.Ensure("www", gojail.WithPath("/jails/www"), gojail.Securelevel(3)); err != nil {
+		t.Errorf("ensure existing: %v", err)
+	}
+	if _, err := gojail.Ensure("www", gojail.WithPath("/jails/other")); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam for changed path, got %v", err)
+	}
+	if _, err := gojail.Ensure("db", gojail.WithPath("/jails/db"), gojail.Persist()); err != nil {
+		t.Errorf("ensure new: %v", err)
+	}
+
+	_, err = gojail.Create("bad",
+		gojail.Securelevel(5),
+		gojail.WithIPv4("2001:db8::1"),
+		gojail.WithParam("vnet", "new"),
+		gojail.WithIPv6("2001:db8::1"))
+	if !errors.Is(err, gojail.ErrInvalidParam) || strings.Count(err.Error(), ";") != 2 {
+		t.Errorf("expected collected errors, got %v", err)
+	}
+	var jerr *gojail.JailErr
+	if !errors.As(err, &jerr) || jerr.Errno != syscall.EINVAL {
+		t.Errorf("expected *JailErr in collected errors, got %v", err)
+	}
+}
+
+// Reports errors without errmsg, like a kernel with different messages.
+type silentKernel struct {
+	*jailtest.Kernel
+}
+
+func (k silentKernel) JailGet(iov [][]byte, flags gojail.Flags) (int, error) {
+	jid, err := k.Kernel.JailGet(iov, flags)
+	for i := 0; i+1 < len(iov); i += 2 {
+		if string(iov[i]) == "errmsg\x00" && len(iov[i+1]) > 0 {
+			iov[i+1][0] = 0
+		}
+	}
+	return jid, err
+}
+
+func TestErrDying(t *testing.T) {
+	k := silentKernel{jailtest.NewKernel()}
+	prev := gojail.SetBackend(k)
+	t.Cleanup(func() { gojail.SetBackend(prev) })
+	j, err := gojail.Create("www", gojail.Persist())
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := k.Hold(j.JID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gojail.Remove(j.JID()); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	for _, key := range []string{"jid", "name"} {
+		var p gojail.JailParam
+		if key == "jid" {
+			p, err = gojail.NewIntParam("jid", j.JID())
+		} else {
+			p, err = gojail.NewStringParam("name", "www")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = gojail.GetParams([]gojail.JailParam{p}, 0)
+		if !errors.Is(err, gojail.ErrDying) || strings.Contains(err.Error(), "dying") {
+			t.Errorf("%s: expected ErrDying without a message saying so, got %v", key, err)
+		}
+	}
+	if _, err := gojail.GetId("other"); !errors.Is(err, gojail.ErrNotFound) || errors.Is(err, gojail.ErrDying) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// Creates a jail right before the first jail_set(2) call with CreateFlag,
+// like a concurrent process would.
+type racingKernel struct {
+	*jailtest.Kernel
+	race func()
+}
+
+func (k *racingKernel) JailSet(iov [][]byte, flags gojail.Flags) (int, error) {
+	if race := k.race; race != nil && flags&gojail.CreateFlag != 0 {
+		k.race = nil
+		race()
+	}
+	return k.Kernel.JailSet(iov, flags)
+}
+
+func TestEnsureRace(t *testing.T) {
+	k := &racingKernel{Kernel: jailtest.NewKernel()}
+	prev := gojail.SetBackend(k)
+	t.Cleanup(func() { gojail.SetBackend(prev) })
+	k.race = func() {
+		if _, err := gojail.Create("www", gojail.WithPath("/jails/www"), gojail.Persist()); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	j, err := gojail.Ensure("www", gojail.WithPath("/jails/www"), gojail.Securelevel(2), gojail.Persist())
+	if err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	level, err := gojail.IntOut("securelevel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Params(level); err != nil || level.Value() != 2 {
+		t.Errorf("expected the jail to be updated, got securelevel %d (%v)", level.Value(), err)
+	}
+}
+
+// Returns an ip4.addr parameter with n addresses.
+func ip4Addrs(t *testing.T, n int) gojail.JailParam {
+	addrs := make([]string, n)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	p, err := gojail.Import("ip4.addr", strings.Join(addrs, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// Adds addresses to a jail after the length of ip4.addr was asked for, the
+// first n times.
+type growingKernel struct {
+	*jailtest.Kernel
+	t     *testing.T
+	jid   int
+	addrs int
+	n     int
+}
+
+func (k *growingKernel) JailGet(iov [][]byte, flags gojail.Flags) (int, error) {
+	jid, err := k.Kernel.JailGet(iov, flags)
+	for i := 0; i+1 < len(iov); i += 2 {
+		if string(iov[i]) == "ip4.addr\x00" && k.n > 0 && len(iov[i+1]) == k.addrs*4 {
+			// Only the length was reported, grow the array.
+			k.n--
+			k.addrs += 10
+			if _, err := gojail.SetParams([]gojail.JailParam{jidParam(k.t, k.jid), ip4Addrs(k.t, k.addrs)}, gojail.UpdateFlag); err != nil {
+				k.t.Fatal(err)
+			}
+		}
+	}
+	return jid, err
+}
+
+func jidParam(t *testing.T, jid int) gojail.JailParam {
+	p, err := gojail.NewIntParam("jid", jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestGetParamsArrays(t *testing.T) {
+	k := &growingKernel{Kernel: jailtest.NewKernel(), t: t}
+	prev := gojail.SetBackend(k)
+	t.Cleanup(func() { gojail.SetBackend(prev) })
+	name, err := gojail.NewStringParam("name", "www")
+	if err != nil {
+		t.Fatal(err)
+	}
+	persist, err := gojail.NewStringParam("persist", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// More than the default of security.jail.jail_max_af_ips.
+	k.addrs = 300
+	k.jid, err = gojail.SetParams([]gojail.JailParam{name, persist, ip4Addrs(t, k.addrs)}, gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	addrs, err := gojail.IPListOut("ip4.addr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gojail.GetParams([]gojail.JailParam{jidParam(t, k.jid), addrs}, 0); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if v := addrs.Value(); len(v) != 300 || v[299].String() != "10.0.1.43" {
+		t.Errorf("expected 300 addresses, got %d", len(v))
+	}
+
+	// The array grows beyond the slop twice before it is read.
+	k.n = 2
+	if _, err := gojail.GetParams([]gojail.JailParam{jidParam(t, k.jid), addrs}, 0); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if v := addrs.Value(); len(v) != 320 {
+		t.Errorf("expected 320 addresses, got %d", len(v))
+	}
+}
+
+type jailConfig struct {
+	Name     string   `jail:"name"`
+	Path     string   `jail:"path"`
+	Persist  bool     `jail:"persist"`
+	Secure   int      `jail:"securelevel"`
+	Addrs    []net.IP `jail:"ip4.addr,omitempty"`
+	Children struct {
+		Max int `jail:"max"`
+	} `jail:"children"`
+	Host struct {
+		Hostname string `jail:"hostname,omitempty"`
+	} `jail:"host"`
+	Allow struct {
+		RawSockets bool `jail:"raw_sockets"`
+		Mount      struct {
+			Devfs bool `jail:"devfs"`
+		} `jail:"mount"`
+	} `jail:"allow"`
+	Other map[string]string `jail:",unknown"`
+}
+
+func TestMarshal(t *testing.T) {
+	useFakeKernel(t)
+	var cfg jailConfig
+	cfg.Name = "www"
+	cfg.Path = "/jails/www"
+	cfg.Persist = true
+	cfg.Secure = 2
+	cfg.Addrs = []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}
+	cfg.Children.Max = 3
+	cfg.Allow.Mount.Devfs = true
+	cfg.Other = map[string]string{"vnet": "inherit"}
+	params, err := gojail.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var names []string
+	for _, p := range params {
+		names = append(names, string(bytes.TrimRight(p.Name(), "\x00")))
+	}
+	want := "name path persist securelevel ip4.addr children.max allow.raw_sockets allow.mount.devfs vnet"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("expected parameters %q, got %q", want, got)
+	}
+	if _, err := gojail.SetParams(params, gojail.CreateFlag); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	j, err := gojail.Open("www")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got jailConfig
+	if err := j.ParamsInto(&got); err != nil {
+		t.Fatalf("params into: %v", err)
+	}
+	got.Other = nil
+	cfg.Other = nil
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("expected %+v, got %+v", cfg, got)
+	}
+
+	out, err := gojail.OutParams(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vnet, err := gojail.Want("vnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gojail.NewIntParam("jid", j.JID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = append(out, vnet, key)
+	if _, err := gojail.GetParams(out, 0); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if err := gojail.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Other["vnet"] != "inherit" {
+		t.Errorf("expected unknown parameters to be captured, got %v", got.Other)
+	}
+
+	var bad struct {
+		Value float64 `jail:"path"`
+	}
+	if _, err := gojail.Marshal(bad); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam for unsupported field, got %v", err)
+	}
+	if err := gojail.Unmarshal(nil, cfg); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam for non-pointer, got %v", err)
+	}
+}
+
+func TestIPListParams(t *testing.T) {
+	useFakeKernel(t)
+	name, err := gojail.NewStringParam("name", "net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs4, err := gojail.NewIPListParam("192.0.2.1", "192.0.2.2", "192.0.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs4.Data()) != 3*net.IPv4len || addrs4.Type() != gojail.IP4 {
+		t.Errorf("unexpected IPv4 list %v of type %s", addrs4.Data(), addrs4.Type())
+	}
+	addrs6, err := gojail.NewIPListParam("2001:db8::1", "2001:db8::2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode, err := gojail.NewIPModeParam(gojail.IP6, gojail.IPNew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saddrsel, err := gojail.NewSaddrselParam(gojail.IP4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	persist, err := gojail.NewStringParam("persist", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := []gojail.JailParam{name, addrs4, addrs6, mode, saddrsel, persist}
+	jid, err := gojail.SetParams(params, gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	key, err := gojail.NewIntParam("jid", jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out4, err := gojail.IPListOut("ip4.addr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out6, err := gojail.IPListOut("ip6.addr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outSaddrsel, err := gojail.Want("ip4.saddrsel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gojail.GetParams([]gojail.JailParam{key, out4, out6, outSaddrsel}, 0); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(out4.Value()) != 3 || !out4.Value()[2].Equal(net.ParseIP("192.0.2.3")) {
+		t.Errorf("unexpected IPv4 addresses %v", out4.Value())
+	}
+	if len(out6.Value()) != 2 || !out6.Value()[1].Equal(net.ParseIP("2001:db8::2")) {
+		t.Errorf("unexpected IPv6 addresses %v", out6.Value())
+	}
+	if outSaddrsel.String() != "false" {
+		t.Errorf("expected ip4.saddrsel to be false, got %s", outSaddrsel)
+	}
+
+	if _, err := gojail.NewIPListParam("192.0.2.1", "2001:db8::1"); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam for mixed families, got %v", err)
+	}
+	if _, err := gojail.NewIPListParam(); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam for empty list, got %v", err)
+	}
+	if _, err := gojail.NewIPModeParam(gojail.String, gojail.IPInherit); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam for invalid family, got %v", err)
+	}
+}
+
+func TestLongParams(t *testing.T) {
+	long, err := gojail.NewLongParam("test.long", -42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ulong, err := gojail.NewUlongParam("test.ulong", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(long.Data()) != strconv.IntSize/8 || len(ulong.Data()) != strconv.IntSize/8 {
+		t.Errorf("expected values of %d bytes, got %d and %d", strconv.IntSize/8, len(long.Data()), len(ulong.Data()))
+	}
+	if s, err := gojail.Export(long); err != nil || s != "-42" {
+		t.Errorf("expected -42, got %q (%v)", s, err)
+	}
+	if s, err := gojail.Export(ulong); err != nil || s != "42" {
+		t.Errorf("expected 42, got %q (%v)", s, err)
+	}
+	if _, err := gojail.NewLongParam("name", 1); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam for wrong type, got %v", err)
+	}
+}
+
+func TestNotSupported(t *testing.T) {
+	if runtime.GOOS == "freebsd" {
+		t.Skip("jails are supported on FreeBSD")
+	}
+	if _, err := gojail.GetId("foo"); !errors.Is(err, gojail.ErrNotSupported) || !errors.Is(err, syscall.ENOSYS) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if err := gojail.Attach(1); !errors.Is(err, gojail.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if _, err := gojail.LoadRegistry(); !errors.Is(err, syscall.ENOSYS) {
+		t.Errorf("expected ENOSYS from the sysctl tree, got %v", err)
+	}
+	if _, ok := gojail.LookupParam("host.hostname"); !ok {
+		t.Errorf("expected the static registry as fallback")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if os.Geteuid() == 0 && runtime.GOOS == "freebsd" {
+		t.Skip("would attach to a real jail")
+	}
+	var stdout bytes.Buffer
+	cmd := gojail.Command(1, "echo", "hello")
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	var je *gojail.JailErr
+	if !errors.As(err, &je) || je.Op != "jail_attach" {
+		t.Fatalf("expected jail_attach to fail, got %v", err)
+	}
+	if runtime.GOOS != "freebsd" && !errors.Is(err, gojail.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if cmd.ProcessState == nil || cmd.ProcessState.ExitCode() == 0 || stdout.Len() != 0 {
+		t.Errorf("expected the helper to fail, got %v, %q", cmd.ProcessState, stdout.String())
+	}
+	if err := cmd.Wait(); err == nil {
+		t.Errorf("expected error waiting twice")
+	}
+}
+
+func TestCommandHostUser(t *testing.T) {
+	cmd := gojail.Command(1, "id")
+	cmd.User = "no-such-user-gojail"
+	cmd.HostUser = true
+	cmd.Clean = true
+	err := cmd.Run()
+	if err == nil || !strings.Contains(err.Error(), "no-such-user-gojail") {
+		t.Errorf("expected lookup of the host user to fail, got %v", err)
+	}
+}
+
+// Creates a persistent jail called name in the fake kernel.
+func createPersistent(t *testing.T, name string) int {
+	jail, err := gojail.Create(name, gojail.WithParam("persist", ""))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	return jail.JID()
+}
+
+func TestStop(t *testing.T) {
+	useFakeKernel(t)
+	jid := createPersistent(t, "db")
+	procs := &jailtest.Processes{}
+	procs.Start(jid, "sh")
+	procs.Start(jid, "postgres", syscall.SIGTERM)
+	stuck := procs.Start(jid, "stuck")
+	procs.SetUnkillable(stuck)
+	procs.Start(jid+100, "other")
+
+	opts := &gojail.StopOptions{
+		GracePeriod:  20 * time.Millisecond,
+		KillTimeout:  20 * time.Millisecond,
+		PollInterval: time.Millisecond,
+		Processes:    procs,
+	}
+	report, err := gojail.Stop(context.Background(), jid, opts)
+	if err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	commands := func(procs []gojail.Process) []string {
+		var names []string
+		for _, p := range procs {
+			names = append(names, p.Command)
+		}
+		return names
+	}
+	if got := commands(report.Terminated); !reflect.DeepEqual(got, []string{"sh", "postgres", "stuck"}) {
+		t.Errorf("unexpected terminated processes %q", got)
+	}
+	if got := commands(report.Killed); !reflect.DeepEqual(got, []string{"postgres", "stuck"}) {
+		t.Errorf("unexpected killed processes %q", got)
+	}
+	if got := commands(report.Remaining); !reflect.DeepEqual(got, []string{"stuck"}) {
+		t.Errorf("unexpected remaining processes %q", got)
+	}
+	signals := procs.Signals()
+	if len(signals) < 5 || !reflect.DeepEqual(signals[:5], []string{"1: SIGTERM", "2: SIGTERM", "3: SIGTERM", "2: SIGKILL", "3: SIGKILL"}) {
+		t.Errorf("unexpected signals %q", signals)
+	}
+	if _, err := gojail.GetId("db"); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected the jail to be removed, got %v", err)
+	}
+
+	// Without processes, the jail vanishes once persist is cleared.
+	jid = createPersistent(t, "idle")
+	opts.Keep = true
+	report, err = gojail.Stop(context.Background(), jid, opts)
+	if err != nil || len(report.Terminated) != 0 {
+		t.Errorf("stop: %+v, %v", report, err)
+	}
+	if _, err := gojail.GetId("idle"); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected the jail to be gone, got %v", err)
+	}
+
+	if _, err := gojail.Stop(context.Background(), jid, opts); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStopCanceled(t *testing.T) {
+	useFakeKernel(t)
+	jid := createPersistent(t, "www")
+	procs := &jailtest.Processes{}
+	procs.Start(jid, "nginx", syscall.SIGTERM)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	report, err := gojail.Stop(ctx, jid, &gojail.StopOptions{Processes: procs})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline to expire, got %v", err)
+	}
+	if report == nil || len(report.Terminated) != 1 || len(report.Killed) != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if _, err := gojail.GetId("www"); err != nil {
+		t.Errorf("expected the jail to be kept, got %v", err)
+	}
+}
+
+func TestWaitGone(t *testing.T) {
+	k := useFakeKernel(t)
+	jid := createPersistent(t, "www")
+	if dying, err := gojail.IsDying(jid); err != nil || dying {
+		t.Errorf("expected live jail, got %v, %v", dying, err)
+	}
+	// A socket keeps the jail around after its removal.
+	if err := k.Hold(jid); err != nil {
+		t.Fatal(err)
+	}
+	if err := gojail.Remove(jid); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if dying, err := gojail.IsDying(jid); err != nil || !dying {
+		t.Errorf("expected dying jail, got %v, %v", dying, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if err := gojail.WaitGone(ctx, jid); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline to expire, got %v", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { k.Release(jid) })
+	if err := gojail.WaitGone(context.Background(), jid); err != nil {
+		t.Errorf("wait: %v", err)
+	}
+	if _, err := gojail.IsDying(jid); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// A new jail with the same name reuses the JID between two polls.
+	jid = createPersistent(t, "www")
+	if err := k.Hold(jid); err != nil {
+		t.Fatal(err)
+	}
+	if err := gojail.Remove(jid); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	reused := jid
+	time.AfterFunc(150*time.Millisecond, func() {
+		k.Release(reused)
+		if _, err := gojail.Create("www", gojail.WithParam("jid", strconv.Itoa(reused)), gojail.Persist()); err != nil {
+			t.Errorf("create: %v", err)
+		}
+	})
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := gojail.WaitGone(ctx, jid); err != nil {
+		t.Errorf("expected the dying jail to be gone, got %v", err)
+	}
+	if err := gojail.Remove(jid); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	jid = createPersistent(t, "www")
+	if err := k.Hold(jid); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { k.Release(jid) })
+	if err := gojail.Remove(jid, gojail.WaitUntilGone(context.Background())); err != nil {
+		t.Errorf("remove: %v", err)
+	}
+	if _, err := gojail.GetId("www"); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected the jail to be gone, got %v", err)
+	}
+}
+
+func TestVnet(t *testing.T) {
+	useFakeKernel(t)
+	j, err := gojail.Create("vnet", gojail.Vnet(), gojail.Persist())
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	vnet, err := gojail.Want("vnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Params(vnet); err != nil || vnet.String() != "new" {
+		t.Errorf("expected vnet=new, got %q, %v", vnet.String(), err)
+	}
+	p, err := gojail.NewVnetParam(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := gojail.Export(p); err != nil || s != "inherit" {
+		t.Errorf("expected inherit, got %q, %v", s, err)
+	}
+	if _, err := gojail.Create("bad", gojail.Vnet(), gojail.WithIPv4("192.0.2.1")); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam, got %v", err)
+	}
+}
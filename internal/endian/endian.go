@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package endian provides the native byte order and the encoding of C long
+// values, which jail parameters use in memory.
+package endian
+
+import "math/bits"
+
+// LongSize is the size of a C long in bytes, which is the size of a pointer
+// on all platforms supported by FreeBSD.
+const LongSize = bits.UintSize / 8
+
+// PutLong encodes v as a C long into b, which must hold at least LongSize
+// bytes. On 32-bit platforms, the upper half of v is dropped.
+func PutLong(b []byte, v uint64) {
+	if LongSize == 4 {
+		Native.PutUint32(b, uint32(v))
+	} else {
+		Native.PutUint64(b, v)
+	}
+}
+
+// Long decodes the C long in b, which must hold at least LongSize bytes.
+// The value is not sign-extended.
+func Long(b []byte) uint64 {
+	if LongSize == 4 {
+		return uint64(Native.Uint32(b))
+	}
+	return Native.Uint64(b)
+}
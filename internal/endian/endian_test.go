@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package endian
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestNative(t *testing.T) {
+	v := uint32(0x01020304)
+	b := (*[4]byte)(unsafe.Pointer(&v))[:]
+	if got := Native.Uint32(b); got != v {
+		t.Errorf("native byte order decodes %#x as %#x", v, got)
+	}
+}
+
+func TestLong(t *testing.T) {
+	if LongSize != int(unsafe.Sizeof(uintptr(0))) {
+		t.Errorf("long size %d differs from pointer size %d", LongSize, unsafe.Sizeof(uintptr(0)))
+	}
+	b := make([]byte, LongSize)
+	PutLong(b, 0x7f000001)
+	if got := Long(b); got != 0x7f000001 {
+		t.Errorf("expected %#x, got %#x", 0x7f000001, got)
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrStale is returned by the methods of Jail if its JID no longer
+// belongs to the jail the handle was created for.
+var ErrStale = errors.New("jail handle is stale")
+
+// Jail is a handle to a jail, recording its JID and name.
+//
+// JIDs are reused once a jail is gone, so before acting on the jail, the
+// methods check that the JID still belongs to a jail of the recorded name,
+// and fail with ErrStale otherwise.
+// The check cannot rule out that the jail is replaced between the check and
+// the operation, but it guards against acting on a jail created long after
+// the handle.
+type Jail struct {
+	jid  int
+	name string
+}
+
+// Open returns a handle to the jail identified by name, which can also be
+// a JID, like GetId.
+func Open(name string) (*Jail, error) {
+	jid, err := GetId(name)
+	if err != nil {
+		return nil, err
+	}
+	return OpenJID(jid)
+}
+
+// OpenJID returns a handle to the jail identified by jid.
+func OpenJID(jid int) (*Jail, error) {
+	name, err := GetName(jid)
+	if err != nil {
+		return nil, err
+	}
+	return &Jail{jid: jid, name: name}, nil
+}
+
+// NewJail creates or updates a jail with SetParams and returns a handle to
+// it.
+func NewJail(params []JailParam, flags Flags) (*Jail, error) {
+	jid, err := SetParams(params, flags)
+	if err != nil {
+		return nil, err
+	}
+	// Jails which are neither persistent nor attached to vanish
+	// immediately, the name is only available from the parameters.
+	if name, ok := paramString(params, "name"); ok {
+		return &Jail{jid: jid, name: name}, nil
+	}
+	return OpenJID(jid)
+}
+
+// Returns the value of the string parameter called name.
+func paramString(params []JailParam, name string) (string, bool) {
+	for _, p := range params {
+		if cstring(p.Name()) == name && p.Type() == String {
+			return cstring(p.Data()), true
+		}
+	}
+	return "", false
+}
+
+// Returns a parameter selecting the jail identified by jid.
+func jidParam(jid int) JailParam {
+	return jailParam{
+		name:  byteSliceFromStringOrDie("jid"),
+		data:  intToBytes(jid),
+		ptype: Int,
+	}
+}
+
+// JID returns the JID of the jail.
+func (j *Jail) JID() int {
+	return j.jid
+}
+
+// Name returns the name of the jail.
+func (j *Jail) Name() string {
+	return j.name
+}
+
+func (j *Jail) String() string {
+	return fmt.Sprintf("%s (JID %d)", j.name, j.jid)
+}
+
+func (j *Jail) staleError() error {
+	return fmt.Errorf("jail %s: %w", j, ErrStale)
+}
+
+// Stale reports whether the JID of the handle no longer belongs to a jail
+// of the recorded name.
+func (j *Jail) Stale() (bool, error) {
+	name, err := GetName(j.jid)
+	if errors.Is(err, ErrNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return name != j.name, nil
+}
+
+// Returns ErrStale if the handle is stale.
+func (j *Jail) check() error {
+	stale, err := j.Stale()
+	if err != nil {
+		return err
+	}
+	if stale {
+		return j.staleError()
+	}
+	return nil
+}
+
+// Params reads parameters of the jail with GetParams, typically output
+// parameters like the ones returned by Want.
+// The name of the jail is checked in the same request.
+func (j *Jail) Params(params ...JailParam) error {
+	name, err := StringOut("name")
+	if err != nil {
+		return err
+	}
+	all := make([]JailParam, 0, len(params)+2)
+	all = append(all, jidParam(j.jid), name)
+	all = append(all, params...)
+	if _, err := GetParams(all, 0); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return j.staleError()
+		}
+		return err
+	}
+	if name.Value() != j.name {
+		return j.staleError()
+	}
+	return nil
+}
+
+// Update sets parameters of the jail with SetParams.
+// If the parameters rename the jail, the handle follows.
+func (j *Jail) Update(params ...JailParam) error {
+	if err := j.check(); err != nil {
+		return err
+	}
+	all := make([]JailParam, 0, len(params)+1)
+	all = append(all, jidParam(j.jid))
+	all = append(all, params...)
+	if _, err := SetParams(all, UpdateFlag); err != nil {
+		return err
+	}
+	if name, ok := paramString(params, "name"); ok {
+		j.name = name
+	}
+	return nil
+}
+
+// Attach attaches the current process to the jail, see Attach.
+func (j *Jail) Attach() error {
+	if err := j.check(); err != nil {
+		return err
+	}
+	return Attach(j.jid)
+}
+
+// Remove removes the jail, see Remove.
+func (j *Jail) Remove(opts ...RemoveOption) error {
+	if err := j.check(); err != nil {
+		return err
+	}
+	return Remove(j.jid, opts...)
+}
+
+// Stop stops the jail gracefully, see Stop.
+func (j *Jail) Stop(ctx context.Context, opts *StopOptions) (*StopReport, error) {
+	if err := j.check(); err != nil {
+		return nil, err
+	}
+	return Stop(ctx, j.jid, opts)
+}
+
+// Refresh looks up the jail by its name and updates the JID of the handle,
+// for example after the jail was recreated.
+func (j *Jail) Refresh() error {
+	jid, err := GetId(j.name)
+	if err != nil {
+		return err
+	}
+	j.jid = jid
+	return nil
+}
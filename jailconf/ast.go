@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailconf
+
+import "fmt"
+
+// Pos is a position in a configuration file.
+type Pos struct {
+	Filename string
+	Line     int // Starting at 1
+	Column   int // Starting at 1, in bytes
+}
+
+func (p Pos) String() string {
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+	return s
+}
+
+// Node is a statement of a configuration file: *Param, *Block, *Include
+// or *Comment.
+type Node interface {
+	// Position returns the position of the first character of the
+	// statement.
+	Position() Pos
+	// BlankBefore reports whether an empty line precedes the statement.
+	BlankBefore() bool
+}
+
+// Op is the operator of a parameter definition.
+type Op int
+
+const (
+	// A parameter given by name only, like "persist;".
+	OpNone Op = iota
+	// "=" sets the value of the parameter.
+	OpSet
+	// "+=" appends to the values of the parameter.
+	OpAppend
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpSet:
+		return "="
+	case OpAppend:
+		return "+="
+	}
+	return ""
+}
+
+// Value is a value as written in the configuration file.
+// Escape sequences and variables are kept in Raw and are only resolved
+// when the parameters of a jail are evaluated.
+type Value struct {
+	Raw   string // Source text, without the quotes
+	Quote byte   // '"' or '\'' for quoted values, 0 otherwise
+}
+
+// Param defines a parameter, or a variable if the name starts with "$".
+type Param struct {
+	Pos    Pos
+	Blank  bool
+	Name   string
+	Op     Op
+	Values []Value
+}
+
+func (p *Param) Position() Pos     { return p.Pos }
+func (p *Param) BlankBefore() bool { return p.Blank }
+
+// Block holds the definitions of a jail.
+// The name "*" and names containing "*" apply to all matching jails.
+// Nested blocks define child jails, the name of a child is the name of
+// its parent and its own, separated by a dot.
+type Block struct {
+	Pos   Pos
+	Blank bool
+	Name  string
+	Body  []Node
+}
+
+func (b *Block) Position() Pos     { return b.Pos }
+func (b *Block) BlankBefore() bool { return b.Blank }
+
+// Include is an ".include" directive. The pattern is a glob relative to
+// the directory of the including file.
+type Include struct {
+	Pos     Pos
+	Blank   bool
+	Pattern Value
+}
+
+func (i *Include) Position() Pos     { return i.Pos }
+func (i *Include) BlankBefore() bool { return i.Blank }
+
+// Comment is a comment, including its delimiters.
+type Comment struct {
+	Pos   Pos
+	Blank bool
+	Text  string
+	// Set if the comment follows another statement or the opening brace
+	// of a block on the same line.
+	Trailing bool
+}
+
+func (c *Comment) Position() Pos     { return c.Pos }
+func (c *Comment) BlankBefore() bool { return c.Blank }
+
+// File is a parsed configuration file.
+type File struct {
+	Filename string
+	Body     []Node
+}
@@ -0,0 +1,371 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailconf
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"purplekraken.com/pkg/gojail"
+)
+
+// Maximum nesting of included files.
+const maxIncludeDepth = 32
+
+// Config is a configuration with all included files read.
+type Config struct {
+	// The statements of the configuration, with the contents of the
+	// included files in place of the .include directives.
+	Body []Node
+}
+
+// Load reads the configuration file path and the files it includes.
+func Load(path string) (*Config, error) {
+	f, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Resolve(f)
+}
+
+// Resolve reads the files included by f. Relative patterns are resolved
+// against the directory of f.Filename.
+func Resolve(f *File) (*Config, error) {
+	seen := map[string]bool{}
+	if abs, err := filepath.Abs(f.Filename); err == nil && f.Filename != "" {
+		seen[abs] = true
+	}
+	body, err := resolve(f.Body, filepath.Dir(f.Filename), seen)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{Body: body}, nil
+}
+
+func resolve(body []Node, dir string, seen map[string]bool) ([]Node, error) {
+	var out []Node
+	for _, n := range body {
+		switch n := n.(type) {
+		case *Include:
+			nodes, err := include(n, dir, seen)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, nodes...)
+		case *Block:
+			nested, err := resolve(n.Body, dir, seen)
+			if err != nil {
+				return nil, err
+			}
+			b := *n
+			b.Body = nested
+			out = append(out, &b)
+		default:
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// Returns the statements of the files matching the pattern of inc.
+func include(inc *Include, dir string, seen map[string]bool) ([]Node, error) {
+	pattern, err := inc.Pattern.literal()
+	if err != nil {
+		return nil, &Error{Pos: inc.Pos, Err: err}
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, &Error{Pos: inc.Pos, Err: err}
+	}
+	if len(paths) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		return nil, &Error{Pos: inc.Pos, Err: fmt.Errorf("%s: no such file", pattern)}
+	}
+	if len(seen) >= maxIncludeDepth {
+		return nil, &Error{Pos: inc.Pos, Err: errors.New("includes nested too deeply")}
+	}
+	var out []Node
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, &Error{Pos: inc.Pos, Err: err}
+		}
+		if seen[abs] {
+			return nil, &Error{Pos: inc.Pos, Err: fmt.Errorf("%s includes itself", p)}
+		}
+		f, err := ParseFile(p)
+		if err != nil {
+			return nil, err
+		}
+		seen[abs] = true
+		nodes, err := resolve(f.Body, filepath.Dir(p), seen)
+		delete(seen, abs)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, nodes...)
+	}
+	return out, nil
+}
+
+// Calls fn for all blocks in body, with the full names of the jails.
+func walkBlocks(body []Node, prefix string, fn func(name string, b *Block)) {
+	for _, n := range body {
+		if b, ok := n.(*Block); ok {
+			name := prefix + b.Name
+			fn(name, b)
+			walkBlocks(b.Body, name+".", fn)
+		}
+	}
+}
+
+func isWildcard(name string) bool {
+	return strings.Contains(name, "*")
+}
+
+// Jails returns the names of the jails defined in the configuration, in
+// the order of their first definition. Wildcard blocks are not included.
+func (c *Config) Jails() []string {
+	var names []string
+	seen := map[string]bool{}
+	walkBlocks(c.Body, "", func(name string, b *Block) {
+		if !isWildcard(name) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	})
+	return names
+}
+
+// Jail holds the effective parameters of a jail.
+type Jail struct {
+	Name string
+	// Parameters for the kernel, in the order of their definition.
+	Params []gojail.JailParam
+	// Parameters handled by jail(8) instead of the kernel, like
+	// exec.start, mount.devfs or interface.
+	Pseudo map[string][]string
+	// The values of all parameters and variables, with variables
+	// substituted.
+	Values map[string][]string
+}
+
+// Names of the pseudo-parameters which are not in the exec and mount
+// namespaces, see jail(8).
+var pseudoParams = map[string]bool{
+	"allow.dying":    true,
+	"command":        true,
+	"depend":         true,
+	"interface":      true,
+	"ip_hostname":    true,
+	"mount":          true,
+	"stop.timeout":   true,
+	"vnet.interface": true,
+}
+
+// IsPseudo reports whether name is a pseudo-parameter, which is handled
+// by jail(8) instead of the kernel.
+func IsPseudo(name string) bool {
+	return pseudoParams[name] || strings.HasPrefix(name, "exec.") || strings.HasPrefix(name, "mount.")
+}
+
+// A value with the position of its definition.
+type posValue struct {
+	Value
+	pos Pos
+}
+
+// The definitions of the parameters and variables of a jail.
+type definitions struct {
+	values map[string][]posValue
+	pos    map[string]Pos // Position of the last definition
+	order  []string
+	// Expanded values, and the parameters being expanded.
+	expanded  map[string][]string
+	expanding map[string]bool
+}
+
+func (d *definitions) define(p *Param) {
+	name := p.Name
+	var values []posValue
+	if p.Op == OpNone {
+		// Negated booleans are stored under the name of the
+		// parameter, so they override earlier definitions.
+		if info, ok := gojail.LookupParam(name); ok && info.Type == gojail.NoBool {
+			name = info.Name
+			values = []posValue{{Value{Raw: "false"}, p.Pos}}
+		}
+	} else {
+		for _, v := range p.Values {
+			values = append(values, posValue{v, p.Pos})
+		}
+	}
+	if _, ok := d.values[name]; !ok {
+		d.order = append(d.order, name)
+	}
+	if p.Op == OpAppend {
+		values = append(d.values[name], values...)
+	}
+	d.values[name] = values
+	d.pos[name] = p.Pos
+}
+
+// Returns the values of the parameter or variable called name, with
+// variables substituted.
+func (d *definitions) expand(name string) ([]string, error) {
+	if values, ok := d.expanded[name]; ok {
+		return values, nil
+	}
+	if d.expanding[name] {
+		return nil, fmt.Errorf("variable %s refers to itself", strings.TrimPrefix(name, "$"))
+	}
+	d.expanding[name] = true
+	defer delete(d.expanding, name)
+	values := []string{}
+	for _, v := range d.values[name] {
+		s, err := v.decode(d.lookup)
+		if err != nil {
+			var e *Error
+			if errors.As(err, &e) {
+				return nil, err
+			}
+			return nil, &Error{Pos: v.pos, Err: err}
+		}
+		values = append(values, s)
+	}
+	d.expanded[name] = values
+	return values, nil
+}
+
+// Resolves a variable reference, which refers to a variable or a
+// parameter.
+func (d *definitions) lookup(name string) (string, error) {
+	for _, key := range []string{"$" + name, name} {
+		if _, ok := d.values[key]; ok {
+			values, err := d.expand(key)
+			if err != nil {
+				return "", err
+			}
+			return strings.Join(values, ","), nil
+		}
+	}
+	return "", fmt.Errorf("undefined variable %s", name)
+}
+
+// Jail returns the effective parameters of the jail called name.
+// They are the global parameters, followed by the parameters of the
+// matching wildcard blocks and then of the blocks of the jail, with later
+// definitions replacing earlier ones unless they are appended by "+=".
+// The variable and parameter "name" are set to the name of the jail.
+func (c *Config) Jail(name string) (*Jail, error) {
+	d := &definitions{
+		values:    map[string][]posValue{},
+		pos:       map[string]Pos{},
+		expanded:  map[string][]string{},
+		expanding: map[string]bool{},
+	}
+	d.define(&Param{Name: "name", Op: OpSet, Values: []Value{{Raw: name, Quote: '\''}}})
+	for _, n := range c.Body {
+		if p, ok := n.(*Param); ok {
+			d.define(p)
+		}
+	}
+	var blocks []*Block
+	walkBlocks(c.Body, "", func(full string, b *Block) {
+		if ok, _ := path.Match(full, name); ok && isWildcard(full) {
+			blocks = append(blocks, b)
+		}
+	})
+	found := false
+	walkBlocks(c.Body, "", func(full string, b *Block) {
+		if full == name {
+			blocks = append(blocks, b)
+			found = true
+		}
+	})
+	if !found {
+		return nil, fmt.Errorf("jail %s is not defined", name)
+	}
+	for _, b := range blocks {
+		for _, n := range b.Body {
+			if p, ok := n.(*Param); ok {
+				d.define(p)
+			}
+		}
+	}
+	// The name cannot be overridden.
+	d.values["name"] = []posValue{{Value{Raw: name, Quote: '\''}, Pos{}}}
+
+	j := &Jail{
+		Name:   name,
+		Pseudo: map[string][]string{},
+		Values: map[string][]string{},
+	}
+	for _, key := range d.order {
+		values, err := d.expand(key)
+		if err != nil {
+			return nil, err
+		}
+		j.Values[key] = values
+		switch {
+		case strings.HasPrefix(key, "$"):
+		case IsPseudo(key):
+			j.Pseudo[key] = values
+		default:
+			if key == "ip4.addr" || key == "ip6.addr" {
+				values = stripAddrs(values)
+			}
+			p, err := gojail.Import(key, strings.Join(values, ","))
+			if err != nil {
+				return nil, &Error{Pos: d.pos[key], Err: err}
+			}
+			j.Params = append(j.Params, p)
+		}
+	}
+	return j, nil
+}
+
+// Removes the interface and the prefix length from addresses in the
+// "interface|address/prefix" form accepted by jail(8).
+func stripAddrs(values []string) []string {
+	addrs := make([]string, len(values))
+	for i, v := range values {
+		if n := strings.IndexByte(v, '|'); n >= 0 {
+			v = v[n+1:]
+		}
+		if n := strings.IndexByte(v, '/'); n >= 0 {
+			v = v[:n]
+		}
+		addrs[i] = strings.TrimSpace(v)
+	}
+	return addrs
+}
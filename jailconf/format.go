@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailconf
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Fprint writes the configuration f to w in canonical form: one statement
+// per line, blocks indented by tabs, and single empty lines kept where
+// the source had one or more.
+// Comments and values are written as they appear in the source.
+func Fprint(w io.Writer, f *File) error {
+	var p printer
+	p.body(f.Body)
+	if p.buf.Len() > 0 {
+		p.buf.WriteByte('\n')
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// Print returns the configuration f in canonical form, see Fprint.
+func Print(f *File) []byte {
+	var buf bytes.Buffer
+	Fprint(&buf, f)
+	return buf.Bytes()
+}
+
+// Format parses the configuration in src and returns it in canonical form.
+// Included files are not read.
+func Format(src []byte) ([]byte, error) {
+	f, err := Parse("", src)
+	if err != nil {
+		return nil, err
+	}
+	return Print(f), nil
+}
+
+type printer struct {
+	buf   bytes.Buffer
+	depth int
+}
+
+// Starts a new line for a statement.
+func (p *printer) newline(blank bool) {
+	if p.buf.Len() == 0 {
+		return
+	}
+	p.buf.WriteByte('\n')
+	if blank {
+		p.buf.WriteByte('\n')
+	}
+	for i := 0; i < p.depth; i++ {
+		p.buf.WriteByte('\t')
+	}
+}
+
+func (p *printer) body(body []Node) {
+	for i, n := range body {
+		if c, ok := n.(*Comment); ok && c.Trailing && p.buf.Len() > 0 {
+			p.buf.WriteByte(' ')
+			p.buf.WriteString(c.Text)
+			continue
+		}
+		p.newline(i > 0 && n.BlankBefore())
+		p.node(n)
+	}
+}
+
+func (p *printer) node(n Node) {
+	switch n := n.(type) {
+	case *Comment:
+		p.buf.WriteString(n.Text)
+	case *Include:
+		p.buf.WriteString(".include ")
+		p.buf.WriteString(n.Pattern.String())
+		p.buf.WriteByte(';')
+	case *Param:
+		p.buf.WriteString(quoteName(n.Name))
+		if n.Op != OpNone {
+			p.buf.WriteByte(' ')
+			p.buf.WriteString(n.Op.String())
+			for i, v := range n.Values {
+				if i > 0 {
+					p.buf.WriteByte(',')
+				}
+				p.buf.WriteByte(' ')
+				p.buf.WriteString(v.String())
+			}
+		}
+		p.buf.WriteByte(';')
+	case *Block:
+		p.buf.WriteString(quoteName(n.Name))
+		p.buf.WriteString(" {")
+		p.depth++
+		p.body(n.Body)
+		p.depth--
+		p.newline(false)
+		p.buf.WriteByte('}')
+	}
+}
+
+// Reports whether s can be written without quotes, with extra allowing
+// additional characters.
+func isWord(s string, extra string) bool {
+	if s == "" || s == ".include" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAlpha(c) || c >= '0' && c <= '9' || strings.IndexByte("._-/:|@%+", c) >= 0 || strings.IndexByte(extra, c) >= 0 {
+			continue
+		}
+		return false
+	}
+	return !strings.Contains(s, "+=") && !strings.Contains(s, "//") && !strings.Contains(s, "/*")
+}
+
+// Returns the name of a parameter, variable or block as written in a
+// configuration.
+func quoteName(name string) string {
+	if isWord(name, "$*") {
+		return name
+	}
+	return NewValue(name).String()
+}
+
+// NewValue returns a value which stands for the literal string s, quoted
+// and escaped as needed. Dollar signs are escaped, so s is not subject to
+// variable substitution.
+func NewValue(s string) Value {
+	if isWord(s, "") {
+		return Value{Raw: s}
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\', '$':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\t':
+			b.WriteString("\\t")
+		case '\r':
+			b.WriteString("\\r")
+		default:
+			if c < ' ' || c == 0x7f {
+				b.WriteString("\\x")
+				b.WriteByte("0123456789abcdef"[c>>4])
+				b.WriteByte("0123456789abcdef"[c&0xf])
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return Value{Raw: b.String(), Quote: '"'}
+}
+
+// String returns the value as written in a configuration, including the
+// quotes.
+func (v Value) String() string {
+	if v.Quote == 0 {
+		return v.Raw
+	}
+	return string(v.Quote) + v.Raw + string(v.Quote)
+}
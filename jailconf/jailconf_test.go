@@ -0,0 +1,347 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailconf_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/jailconf"
+)
+
+const testConf = `# Defaults for all jails
+exec.start = "/bin/sh /etc/rc";
+exec.stop = "/bin/sh /etc/rc.shutdown";
+exec.clean;
+mount.devfs;
+$domain = example.org;
+path = "/jails/$name";
+host.hostname = "${name}.$domain"; // the FQDN
+
+/*
+ * Web server
+ */
+www {
+	ip4.addr = em0|192.0.2.1/24, 192.0.2.2;
+	ip4.addr += 192.0.2.3;
+	allow.raw_sockets;
+	nopersist;
+	securelevel = 2;
+	exec.poststart += 'echo $name started';
+}
+
+"*" {
+	persist;
+	devfs_ruleset = 4;
+}
+
+db {
+	child {
+		path = /jails/db/child;
+	}
+	osrelease = "13.2-RELEASE\t\"custom\"";
+}
+db.other { }
+`
+
+func parseConfig(t *testing.T, src string) *jailconf.Config {
+	f, err := jailconf.Parse("jail.conf", []byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	c, err := jailconf.Resolve(f)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	return c
+}
+
+func exported(t *testing.T, j *jailconf.Jail) map[string]string {
+	m := map[string]string{}
+	for _, p := range j.Params {
+		s, err := gojail.Export(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m[strings.TrimRight(string(p.Name()), "\x00")] = s
+	}
+	return m
+}
+
+func TestJail(t *testing.T) {
+	c := parseConfig(t, testConf)
+	if got, want := c.Jails(), []string{"www", "db", "db.child", "db.other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected jails %v, got %v", want, got)
+	}
+
+	www, err := c.Jail("www")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := exported(t, www)
+	want := map[string]string{
+		"name":              "www",
+		"path":              "/jails/www",
+		"host.hostname":     "www.example.org",
+		"ip4.addr":          "192.0.2.1,192.0.2.2,192.0.2.3",
+		"allow.raw_sockets": "true",
+		"persist":           "false",
+		"securelevel":       "2",
+		"devfs_ruleset":     "4",
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("expected parameters %v, got %v", want, params)
+	}
+	if got := www.Pseudo["exec.poststart"]; len(got) != 1 || got[0] != "echo $name started" {
+		t.Errorf("expected single-quoted value to be literal, got %q", got)
+	}
+	if got := www.Pseudo["exec.start"]; len(got) != 1 || got[0] != "/bin/sh /etc/rc" {
+		t.Errorf("unexpected exec.start %q", got)
+	}
+	if _, ok := www.Pseudo["mount.devfs"]; !ok {
+		t.Errorf("expected mount.devfs in %v", www.Pseudo)
+	}
+	if got := www.Values["ip4.addr"][0]; got != "em0|192.0.2.1/24" {
+		t.Errorf("expected the address as written, got %q", got)
+	}
+	if _, ok := www.Values["$domain"]; !ok {
+		t.Errorf("expected the variable in the values")
+	}
+
+	child, err := c.Jail("db.child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params = exported(t, child)
+	if params["path"] != "/jails/db/child" || params["host.hostname"] != "db.child.example.org" || params["persist"] != "true" {
+		t.Errorf("unexpected parameters of db.child: %v", params)
+	}
+	db, err := c.Jail("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exported(t, db)["osrelease"]; got != "13.2-RELEASE\t\"custom\"" {
+		t.Errorf("unexpected escaped value %q", got)
+	}
+
+	if _, err := c.Jail("none"); err == nil {
+		t.Errorf("expected error for undefined jail")
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	f, err := jailconf.Parse("", []byte(testConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, n := range f.Body[:10] {
+		switch n := n.(type) {
+		case *jailconf.Comment:
+			kind := "comment"
+			if n.Trailing {
+				kind = "trailing"
+			}
+			kinds = append(kinds, kind)
+		case *jailconf.Param:
+			kinds = append(kinds, n.Name)
+		case *jailconf.Block:
+			kinds = append(kinds, "block "+n.Name)
+		}
+	}
+	want := []string{"comment", "exec.start", "exec.stop", "exec.clean", "mount.devfs", "$domain", "path", "host.hostname", "trailing", "comment"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("expected %v, got %v", want, kinds)
+	}
+	if !f.Body[9].BlankBefore() || f.Body[9].Position().Line != 10 {
+		t.Errorf("unexpected position of the block comment %v", f.Body[9].Position())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"foo = bar", "t.conf:1:10: expected \";\", found end of file"},
+		{"foo {\n\tbar;\n", "t.conf:3:1: expected \"}\", found end of file"},
+		{"foo = \"bar;\n", "t.conf:1:7: unterminated string"},
+		{"}", "t.conf:1:1: unexpected \"}\""},
+		{"a;\n  /* open", "t.conf:2:3: unterminated comment"},
+		{"foo = ;", "t.conf:1:7: expected value, found \";\""},
+		{"foo bar;", "t.conf:1:5: expected \"=\", \"+=\", \";\" or \"{\", found \"bar\""},
+	}
+	for _, test := range tests {
+		_, err := jailconf.Parse("t.conf", []byte(test.src))
+		var e *jailconf.Error
+		if !errors.As(err, &e) || err.Error() != test.err {
+			t.Errorf("%q: expected error %q, got %v", test.src, test.err, err)
+		}
+	}
+
+	c := parseConfig(t, "a {\n\tpath = $undefined;\n}\nb {\n\tsecurelevel = high;\n}\nc { $x = $y; $y = $x; path = $x; }\n")
+	for name, want := range map[string]string{
+		"a": "jail.conf:2:2: undefined variable undefined",
+		"b": "jail.conf:5:2: securelevel: invalid int value \"high\"",
+		"c": "refers to itself",
+	} {
+		_, err := c.Jail(name)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error %q, got %v", name, want, err)
+		}
+	}
+	if _, err := c.Jail("b"); !errors.Is(err, gojail.ErrInvalidParam) {
+		t.Errorf("expected ErrInvalidParam, got %v", err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"jail.conf":            "path = \"/jails/$name\";\n.include \"jail.conf.d/*.conf\";\n",
+		"jail.conf.d/a.conf":   "a { persist; }\n",
+		"jail.conf.d/b.conf":   "b { .include \"../common\"; }\n",
+		"jail.conf.d/c.notinc": "c { }\n",
+		"common":               "securelevel = 3;\n",
+		"loop.conf":            ".include \"loop.conf\";\n",
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := jailconf.Load(filepath.Join(dir, "jail.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Jails(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("expected jails a and b, got %v", got)
+	}
+	b, err := c.Jail("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exported(t, b); got["securelevel"] != "3" || got["path"] != "/jails/b" {
+		t.Errorf("unexpected parameters %v", got)
+	}
+	if _, err := jailconf.Load(filepath.Join(dir, "loop.conf")); err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("expected include loop error, got %v", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	src := `# Global
+exec.start="/bin/sh /etc/rc"  ;   mount.devfs ;# devfs
+
+
+www{ip4.addr=192.0.2.1,192.0.2.2;  // addresses
+  /* block
+     comment */
+    host.hostname   +=   'www' ;
+child { persist; }
+empty {}
+}
+"*" { securelevel = 3; }
+`
+	want := `# Global
+exec.start = "/bin/sh /etc/rc";
+mount.devfs; # devfs
+
+www {
+	ip4.addr = 192.0.2.1, 192.0.2.2; // addresses
+	/* block
+     comment */
+	host.hostname += 'www';
+	child {
+		persist;
+	}
+	empty {
+	}
+}
+* {
+	securelevel = 3;
+}
+`
+	got, err := jailconf.Format([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+	again, err := jailconf.Format(got)
+	if err != nil || string(again) != string(got) {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+
+	f, err := jailconf.Parse("", []byte(testConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := parseConfig(t, string(jailconf.Print(f)))
+	orig := parseConfig(t, testConf)
+	for _, name := range orig.Jails() {
+		j1, err1 := orig.Jail(name)
+		j2, err2 := c.Jail(name)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("%s: %v, %v", name, err1, err2)
+		}
+		if !reflect.DeepEqual(j1.Values, j2.Values) {
+			t.Errorf("%s: expected %v after printing, got %v", name, j1.Values, j2.Values)
+		}
+	}
+}
+
+func TestNewValue(t *testing.T) {
+	values := []string{"plain", "/bin/sh /etc/rc", "$HOME \"quoted\"\n", "a\\b", "", "x+=y", "\x01"}
+	f := &jailconf.File{}
+	block := &jailconf.Block{Name: "test jail"}
+	for _, v := range values {
+		block.Body = append(block.Body, &jailconf.Param{Name: "exec.start", Op: jailconf.OpAppend, Values: []jailconf.Value{jailconf.NewValue(v)}})
+	}
+	f.Body = append(f.Body, block)
+	if v := jailconf.NewValue("plain"); v.Quote != 0 {
+		t.Errorf("expected plain value to be unquoted, got %s", v)
+	}
+	c := parseConfig(t, string(jailconf.Print(f)))
+	j, err := c.Jail("test jail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := j.Pseudo["exec.start"]; !reflect.DeepEqual(got, values) {
+		t.Errorf("expected %q, got %q", values, got)
+	}
+}
@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package jailconf reads jail.conf(5) files, as used by jail(8).
+//
+// Parse returns the syntax tree of a file, which keeps comments and the
+// order of the statements. Resolve reads the included files and returns
+// a Config, which evaluates the parameters of individual jails.
+package jailconf
+
+import (
+	"fmt"
+	"os"
+)
+
+// Error is an error at a position in a configuration file.
+type Error struct {
+	Pos Pos
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type parser struct {
+	s        *scanner
+	it       item   // Current token
+	prevLine int    // Line of the last token which was not a comment
+	comments []Node // Comments read since the last statement
+}
+
+// Parse parses the configuration in src, filename is used in positions
+// only.
+func Parse(filename string, src []byte) (*File, error) {
+	p := &parser{s: newScanner(filename, src)}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	body, err := p.parseBody(false)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Filename: filename, Body: body}, nil
+}
+
+// ParseFile reads and parses the configuration file path.
+func ParseFile(path string) (*File, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, src)
+}
+
+// Advances to the next token which is not a comment, collecting the
+// comments on the way.
+func (p *parser) next() error {
+	p.prevLine = p.it.endLine
+	for {
+		it, err := p.s.next()
+		if err != nil {
+			return err
+		}
+		if it.tok != tokComment {
+			p.it = it
+			return nil
+		}
+		trailing := it.pos.Line == p.prevLine && p.prevLine > 0 && len(p.comments) == 0
+		p.comments = append(p.comments, &Comment{
+			Pos:      it.pos,
+			Blank:    it.blank,
+			Text:     it.lit,
+			Trailing: trailing,
+		})
+	}
+}
+
+func (p *parser) errorf(pos Pos, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Err: fmt.Errorf(format, args...)}
+}
+
+func (p *parser) expect(tok token) error {
+	if p.it.tok != tok {
+		return p.unexpected(tok.String())
+	}
+	return p.next()
+}
+
+func (p *parser) unexpected(want string) error {
+	it := p.it
+	found := it.tok.String()
+	if it.tok == tokWord || it.tok == tokString {
+		found = fmt.Sprintf("%q", it.lit)
+	}
+	return p.errorf(it.pos, "expected %s, found %s", want, found)
+}
+
+// Moves the collected comments to body.
+func (p *parser) flushComments(body []Node) []Node {
+	body = append(body, p.comments...)
+	p.comments = nil
+	return body
+}
+
+// Parses statements up to the end of the file, or up to the closing brace
+// of a block.
+func (p *parser) parseBody(block bool) ([]Node, error) {
+	var body []Node
+	for {
+		body = p.flushComments(body)
+		switch p.it.tok {
+		case tokEOF:
+			if block {
+				return nil, p.unexpected(tokRBrace.String())
+			}
+			return body, nil
+		case tokRBrace:
+			if !block {
+				return nil, p.errorf(p.it.pos, "unexpected \"}\"")
+			}
+			return body, nil
+		}
+		n, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, n)
+	}
+}
+
+func (p *parser) value() Value {
+	return Value{Raw: p.it.lit, Quote: p.it.quote}
+}
+
+func (p *parser) parseStmt() (Node, error) {
+	if p.it.tok != tokWord && p.it.tok != tokString {
+		return nil, p.unexpected("parameter name")
+	}
+	pos, blank := p.it.pos, p.it.blank
+	nameValue := p.value()
+	if p.it.tok == tokWord && p.it.lit == ".include" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.it.tok != tokWord && p.it.tok != tokString {
+			return nil, p.unexpected("file name")
+		}
+		inc := &Include{Pos: pos, Blank: blank, Pattern: p.value()}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return inc, p.expect(tokSemi)
+	}
+	name, err := nameValue.literal()
+	if err != nil {
+		return nil, &Error{Pos: pos, Err: err}
+	}
+	if name == "" {
+		return nil, p.errorf(pos, "empty name")
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	switch p.it.tok {
+	case tokLBrace:
+		b := &Block{Pos: pos, Blank: blank, Name: name}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if b.Body, err = p.parseBody(true); err != nil {
+			return nil, err
+		}
+		return b, p.next()
+	case tokSemi:
+		return &Param{Pos: pos, Blank: blank, Name: name}, p.next()
+	case tokSet, tokAppend:
+	default:
+		return nil, p.unexpected("\"=\", \"+=\", \";\" or \"{\"")
+	}
+
+	param := &Param{Pos: pos, Blank: blank, Name: name, Op: OpSet}
+	if p.it.tok == tokAppend {
+		param.Op = OpAppend
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	for {
+		if p.it.tok != tokWord && p.it.tok != tokString {
+			return nil, p.unexpected("value")
+		}
+		param.Values = append(param.Values, p.value())
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.it.tok != tokComma {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return param, p.expect(tokSemi)
+}
@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailconf
+
+import (
+	"errors"
+	"strings"
+)
+
+type token int
+
+const (
+	tokEOF     token = iota
+	tokWord          // Unquoted string
+	tokString        // Quoted string
+	tokComment       // Comment, including delimiters
+	tokLBrace        // {
+	tokRBrace        // }
+	tokSemi          // ;
+	tokComma         // ,
+	tokSet           // =
+	tokAppend        // +=
+)
+
+var tokenNames = [...]string{
+	tokEOF:     "end of file",
+	tokWord:    "string",
+	tokString:  "quoted string",
+	tokComment: "comment",
+	tokLBrace:  "\"{\"",
+	tokRBrace:  "\"}\"",
+	tokSemi:    "\";\"",
+	tokComma:   "\",\"",
+	tokSet:     "\"=\"",
+	tokAppend:  "\"+=\"",
+}
+
+var punctuation = map[byte]token{
+	'{': tokLBrace,
+	'}': tokRBrace,
+	';': tokSemi,
+	',': tokComma,
+	'=': tokSet,
+}
+
+func (t token) String() string {
+	return tokenNames[t]
+}
+
+// A token with its position and text.
+type item struct {
+	tok     token
+	pos     Pos
+	endLine int    // Line of the last character
+	lit     string // Text of words, strings and comments
+	quote   byte   // Quote character of strings
+	blank   bool   // Preceded by an empty line
+}
+
+type scanner struct {
+	filename string
+	src      string
+	off      int
+	line     int
+	col      int
+}
+
+func newScanner(filename string, src []byte) *scanner {
+	return &scanner{filename: filename, src: string(src), line: 1, col: 1}
+}
+
+func (s *scanner) pos() Pos {
+	return Pos{Filename: s.filename, Line: s.line, Column: s.col}
+}
+
+func (s *scanner) errorf(pos Pos, msg string) error {
+	return &Error{Pos: pos, Err: errors.New(msg)}
+}
+
+func (s *scanner) peek(i int) byte {
+	if s.off+i < len(s.src) {
+		return s.src[s.off+i]
+	}
+	return 0
+}
+
+func (s *scanner) advance() {
+	if s.src[s.off] == '\n' {
+		s.line++
+		s.col = 1
+	} else {
+		s.col++
+	}
+	s.off++
+}
+
+// Skips white space and reports whether it contained an empty line.
+func (s *scanner) skipSpace() bool {
+	newlines := 0
+	for s.off < len(s.src) {
+		switch s.src[s.off] {
+		case '\n':
+			newlines++
+		case ' ', '\t', '\r', '\f', '\v':
+		default:
+			return newlines > 1
+		}
+		s.advance()
+	}
+	return newlines > 1
+}
+
+// Characters which end an unquoted string.
+func isDelim(s *scanner) bool {
+	switch c := s.peek(0); c {
+	case ' ', '\t', '\r', '\n', '\f', '\v', '{', '}', ';', ',', '=', '"', '\'', '#':
+		return true
+	case '/':
+		return s.peek(1) == '/' || s.peek(1) == '*'
+	case '+':
+		return s.peek(1) == '='
+	}
+	return false
+}
+
+func (s *scanner) next() (item, error) {
+	blank := s.skipSpace()
+	it := item{pos: s.pos(), blank: blank}
+	if s.off >= len(s.src) {
+		it.tok = tokEOF
+		it.endLine = s.line
+		return it, nil
+	}
+	start := s.off
+	switch c := s.peek(0); {
+	case punctuation[c] != tokEOF:
+		it.tok = punctuation[c]
+		s.advance()
+	case c == '+' && s.peek(1) == '=':
+		it.tok = tokAppend
+		s.advance()
+		s.advance()
+	case c == '#' || (c == '/' && s.peek(1) == '/'):
+		it.tok = tokComment
+		for s.off < len(s.src) && s.peek(0) != '\n' {
+			s.advance()
+		}
+		it.lit = strings.TrimRight(s.src[start:s.off], " \t\r")
+	case c == '/' && s.peek(1) == '*':
+		it.tok = tokComment
+		s.advance()
+		s.advance()
+		for s.off < len(s.src) && !(s.peek(0) == '*' && s.peek(1) == '/') {
+			s.advance()
+		}
+		if s.off >= len(s.src) {
+			return it, s.errorf(it.pos, "unterminated comment")
+		}
+		s.advance()
+		s.advance()
+		it.lit = s.src[start:s.off]
+	case c == '"' || c == '\'':
+		it.tok = tokString
+		it.quote = c
+		s.advance()
+		for s.off < len(s.src) && s.peek(0) != c {
+			if c == '"' && s.peek(0) == '\\' && s.off+1 < len(s.src) {
+				s.advance()
+			}
+			s.advance()
+		}
+		if s.off >= len(s.src) {
+			return it, s.errorf(it.pos, "unterminated string")
+		}
+		it.lit = s.src[start+1 : s.off]
+		s.advance()
+	default:
+		it.tok = tokWord
+		for s.off < len(s.src) && !isDelim(s) {
+			switch {
+			case s.peek(0) == '\\' && s.off+1 < len(s.src):
+				s.advance()
+			case s.peek(0) == '$' && s.peek(1) == '{':
+				for s.off < len(s.src) && s.peek(0) != '}' {
+					s.advance()
+				}
+				if s.off >= len(s.src) {
+					return it, s.errorf(it.pos, "unterminated variable")
+				}
+			}
+			s.advance()
+		}
+		it.lit = s.src[start:s.off]
+	}
+	it.endLine = s.line
+	if s.off > 0 && s.src[s.off-1] == '\n' {
+		it.endLine--
+	}
+	return it, nil
+}
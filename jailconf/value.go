@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailconf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Returns the value with escape sequences resolved, variables are kept.
+func (v Value) literal() (string, error) {
+	return v.decode(nil)
+}
+
+// Resolves escape sequences and, if lookup is not nil, variables.
+// Single-quoted values are taken literally.
+func (v Value) decode(lookup func(name string) (string, error)) (string, error) {
+	if v.Quote == '\'' {
+		return v.Raw, nil
+	}
+	var b strings.Builder
+	raw := v.Raw
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\' && i+1 < len(raw):
+			i++
+			if v.Quote == 0 {
+				b.WriteByte(raw[i])
+				continue
+			}
+			n, s := unescape(raw[i:])
+			b.WriteString(s)
+			i += n - 1
+		case c == '$' && lookup != nil:
+			name, n := varName(raw[i+1:])
+			if n == 0 {
+				b.WriteByte(c)
+				continue
+			}
+			if name == "" {
+				return "", fmt.Errorf("invalid variable %q", raw[i:i+1+n])
+			}
+			s, err := lookup(name)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+			i += n
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// Resolves the escape sequence at the start of s, following the
+// backslash, and returns its length and its value.
+func unescape(s string) (int, string) {
+	switch c := s[0]; c {
+	case 'a':
+		return 1, "\a"
+	case 'b':
+		return 1, "\b"
+	case 'f':
+		return 1, "\f"
+	case 'n':
+		return 1, "\n"
+	case 'r':
+		return 1, "\r"
+	case 't':
+		return 1, "\t"
+	case 'v':
+		return 1, "\v"
+	case '\n':
+		// Line continuation
+		return 1, ""
+	case 'x':
+		n := 1
+		for n < 3 && n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+			n++
+		}
+		if n == 1 {
+			return 1, "x"
+		}
+		u, _ := strconv.ParseUint(s[1:n], 16, 8)
+		return n, string([]byte{byte(u)})
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n := 1
+		for n < 3 && n < len(s) && s[n] >= '0' && s[n] <= '7' {
+			n++
+		}
+		u, _ := strconv.ParseUint(s[:n], 8, 16)
+		return n, string([]byte{byte(u)})
+	default:
+		return 1, s[:1]
+	}
+}
+
+// Returns the name of the variable reference at the start of s, following
+// the dollar sign, and the length of the reference.
+// The length is 0 if s does not start with a variable name, the name is
+// empty if the reference is invalid.
+func varName(s string) (string, int) {
+	if strings.HasPrefix(s, "{") {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return "", len(s)
+		}
+		return s[1:end], end + 1
+	}
+	n := 0
+	for n < len(s) && (s[n] == '_' || isAlpha(s[n]) || (n > 0 && s[n] >= '0' && s[n] <= '9')) {
+		n++
+	}
+	return s[:n], n
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Interfaces is a fake network.Interfaces, which records the interfaces
+// of the host and the jails and the operations on them.
+// Bridges are added with AddBridge, epairs are called epair0a and epair0b,
+// epair1a and epair1b and so on.
+// The zero value has no interfaces.
+type Interfaces struct {
+	mu     sync.Mutex
+	ifs    map[string]*iface // by JID and name, like "0/epair0a"
+	epairs int
+	log    []string
+	// Errors returned by the operation given by its name and the
+	// interface, like "MoveToJail epair0b".
+	Fail map[string]error
+}
+
+type iface struct {
+	jid     int
+	name    string
+	up      bool
+	bridge  string
+	members []string
+	peer    *iface
+}
+
+func ifKey(jid int, name string) string {
+	return fmt.Sprintf("%d/%s", jid, name)
+}
+
+// Records the operation and returns its error, if any.
+func (f *Interfaces) do(op, name string) error {
+	f.log = append(f.log, op+" "+name)
+	return f.Fail[op+" "+name]
+}
+
+func (f *Interfaces) add(i *iface) {
+	if f.ifs == nil {
+		f.ifs = make(map[string]*iface)
+	}
+	f.ifs[ifKey(i.jid, i.name)] = i
+}
+
+// Finds the interface name in the jail jid.
+func (f *Interfaces) find(jid int, name string) (*iface, error) {
+	i, ok := f.ifs[ifKey(jid, name)]
+	if !ok {
+		return nil, syscall.ENXIO
+	}
+	return i, nil
+}
+
+// AddBridge adds a bridge(4) called name to the host.
+func (f *Interfaces) AddBridge(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.add(&iface{name: name})
+}
+
+// CreateEpair creates an epair on the host.
+func (f *Interfaces) CreateEpair() (string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.do("CreateEpair", "epair"); err != nil {
+		return "", "", err
+	}
+	a := &iface{name: fmt.Sprintf("epair%da", f.epairs)}
+	b := &iface{name: fmt.Sprintf("epair%db", f.epairs), peer: a}
+	a.peer = b
+	f.epairs++
+	f.add(a)
+	f.add(b)
+	return a.name, b.name, nil
+}
+
+// Destroy destroys the interface name on the host, and its peer wherever
+// it is.
+func (f *Interfaces) Destroy(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.do("Destroy", name); err != nil {
+		return err
+	}
+	i, err := f.find(0, name)
+	if err != nil {
+		return err
+	}
+	for _, i := range []*iface{i, i.peer} {
+		if i == nil {
+			continue
+		}
+		if i.bridge != "" {
+			f.removeMember(i.bridge, i.name)
+		}
+		delete(f.ifs, ifKey(i.jid, i.name))
+	}
+	return nil
+}
+
+func (f *Interfaces) removeMember(bridge, member string) error {
+	br, err := f.find(0, bridge)
+	if err != nil {
+		return err
+	}
+	for n, m := range br.members {
+		if m == member {
+			br.members = append(br.members[:n], br.members[n+1:]...)
+			if i, err := f.find(0, member); err == nil {
+				i.bridge = ""
+			}
+			return nil
+		}
+	}
+	return syscall.ENOENT
+}
+
+// AddToBridge adds the host interface member to bridge.
+func (f *Interfaces) AddToBridge(bridge, member string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.do("AddToBridge", bridge+" "+member); err != nil {
+		return err
+	}
+	br, err := f.find(0, bridge)
+	if err != nil {
+		return err
+	}
+	i, err := f.find(0, member)
+	if err != nil {
+		return err
+	}
+	if i.bridge != "" {
+		return syscall.EBUSY
+	}
+	i.bridge = bridge
+	br.members = append(br.members, member)
+	return nil
+}
+
+// RemoveFromBridge removes the host interface member from bridge.
+func (f *Interfaces) RemoveFromBridge(bridge, member string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.do("RemoveFromBridge", bridge+" "+member); err != nil {
+		return err
+	}
+	return f.removeMember(bridge, member)
+}
+
+// Moves the interface name from the stack of from to the one of to.
+func (f *Interfaces) move(op, name string, from, to int) error {
+	if err := f.do(op, name); err != nil {
+		return err
+	}
+	i, err := f.find(from, name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.find(to, name); err == nil {
+		return syscall.EEXIST
+	}
+	delete(f.ifs, ifKey(from, name))
+	i.jid = to
+	i.up = false
+	f.add(i)
+	return nil
+}
+
+// MoveToJail moves the interface name from the host into the jail jid.
+func (f *Interfaces) MoveToJail(name string, jid int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.move("MoveToJail", name, 0, jid)
+}
+
+// MoveFromJail moves the interface name from the jail jid to the host.
+func (f *Interfaces) MoveFromJail(name string, jid int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.move("MoveFromJail", name, jid, 0)
+}
+
+// Rename renames the interface name in the jail jid.
+func (f *Interfaces) Rename(jid int, name, newName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.do("Rename", name+" "+newName); err != nil {
+		return err
+	}
+	i, err := f.find(jid, name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.find(jid, newName); err == nil {
+		return syscall.EEXIST
+	}
+	delete(f.ifs, ifKey(jid, name))
+	i.name = newName
+	f.add(i)
+	return nil
+}
+
+// SetUp brings the interface name in the jail jid up.
+func (f *Interfaces) SetUp(jid int, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.do("SetUp", name); err != nil {
+		return err
+	}
+	i, err := f.find(jid, name)
+	if err != nil {
+		return err
+	}
+	i.up = true
+	return nil
+}
+
+// Interfaces returns the interfaces as text, sorted, like
+// "0/bridge0 members=epair0a" or "3/eth0 up".
+func (f *Interfaces) Interfaces() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ifs []string
+	for key, i := range f.ifs {
+		s := key
+		if i.up {
+			s += " up"
+		}
+		if len(i.members) > 0 {
+			s += " members=" + strings.Join(i.members, ",")
+		}
+		ifs = append(ifs, s)
+	}
+	sort.Strings(ifs)
+	return ifs
+}
+
+// Log returns the operations so far, like "MoveToJail epair0b".
+func (f *Interfaces) Log() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.log...)
+}
@@ -0,0 +1,596 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package jailtest provides an in-memory implementation of the jail system
+// calls, so code using gojail can be tested without a FreeBSD host.
+package jailtest // import "purplekraken.com/pkg/gojail/jailtest"
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"purplekraken.com/pkg/gojail"
+)
+
+const maxJID = 999999 // JAIL_MAX in sys/jail.h
+
+var nameInfo, _ = registry.Lookup("name")
+
+// Kernel is a fake jail subsystem implementing gojail.Backend.
+//
+// It follows the rules of jail_set(2), jail_get(2), jail_attach(2) and
+// jail_remove(2) for a single level of jails below the host: JIDs are
+// allocated in ascending order, names are unique among the live jails,
+// jails without the persist parameter vanish once nothing references them
+// and removed jails linger in the dying state until their last reference
+// is released.
+// Errors are reported as syscall.Errno values, together with the same
+// messages the kernel writes to the "errmsg" parameter.
+//
+// Attaching to a jail only records a reference, the calling process is not
+// affected.
+// The zero value is not usable, create instances with NewKernel.
+type Kernel struct {
+	mu      sync.Mutex
+	jails   map[int]*jail
+	lastjid int
+}
+
+type jail struct {
+	jid     int
+	name    string
+	persist bool
+	dying   bool
+	refs    int
+	values  map[string][]byte
+}
+
+// NewKernel returns a fake kernel without any jails.
+func NewKernel() *Kernel {
+	return &Kernel{
+		jails: make(map[int]*jail),
+	}
+}
+
+// Error from the fake kernel, reported as errno and errmsg.
+type kernErr struct {
+	errno syscall.Errno
+	msg   string
+}
+
+func fail(errno syscall.Errno, format string, args ...interface{}) *kernErr {
+	return &kernErr{
+		errno: errno,
+		msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+// A name and value pair from the iovec array.
+type option struct {
+	name  string
+	value []byte
+	pos   int // index of the value in the iovec array
+}
+
+type options struct {
+	opts   []option
+	errmsg []byte
+}
+
+func parseOptions(iov [][]byte) (*options, *kernErr) {
+	if len(iov)%2 != 0 {
+		return nil, &kernErr{errno: syscall.EINVAL}
+	}
+	o := &options{}
+	for i := 0; i < len(iov); i += 2 {
+		name := iov[i]
+		if len(name) == 0 || name[len(name)-1] != 0 {
+			return nil, &kernErr{errno: syscall.EINVAL}
+		}
+		opt := option{
+			name:  string(name[:len(name)-1]),
+			value: iov[i+1],
+			pos:   i + 1,
+		}
+		if opt.name == "errmsg" {
+			o.errmsg = opt.value
+			continue
+		}
+		o.opts = append(o.opts, opt)
+	}
+	return o, nil
+}
+
+func (o *options) get(name string) (option, bool) {
+	for _, opt := range o.opts {
+		if opt.name == name {
+			return opt, true
+		}
+	}
+	return option{}, false
+}
+
+func (o *options) getInt(name string) (int, bool, *kernErr) {
+	opt, ok := o.get(name)
+	if !ok {
+		return 0, false, nil
+	}
+	if len(opt.value) != 4 {
+		return 0, false, &kernErr{errno: syscall.EINVAL}
+	}
+	return decodeInt(opt.value), true, nil
+}
+
+func (o *options) getString(name string, size int) (string, bool, *kernErr) {
+	opt, ok := o.get(name)
+	if !ok {
+		return "", false, nil
+	}
+	s, err := decodeString(opt.value, size)
+	return s, true, err
+}
+
+func decodeString(b []byte, size int) (string, *kernErr) {
+	n := bytes.IndexByte(b, 0)
+	if n < 0 {
+		return "", &kernErr{errno: syscall.EINVAL}
+	}
+	if size > 0 && n >= size {
+		return "", &kernErr{errno: syscall.ENAMETOOLONG}
+	}
+	return string(b[:n]), nil
+}
+
+// Reports err to the caller through errno and the errmsg parameter.
+func (o *options) fail(err *kernErr) (int, error) {
+	if o != nil && len(o.errmsg) > 0 && err.msg != "" {
+		n := copy(o.errmsg[:len(o.errmsg)-1], err.msg)
+		o.errmsg[n] = 0
+	}
+	return -1, err.errno
+}
+
+// JailSet implements jail_set(2).
+func (k *Kernel) JailSet(iov [][]byte, flags gojail.Flags) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	o, err := parseOptions(iov)
+	if err != nil {
+		return o.fail(err)
+	}
+	jid, err := k.set(o, flags)
+	if err != nil {
+		return o.fail(err)
+	}
+	return jid, nil
+}
+
+func (k *Kernel) set(o *options, flags gojail.Flags) (int, *kernErr) {
+	const allFlags = gojail.CreateFlag | gojail.UpdateFlag | gojail.AttachFlag | gojail.AllowDyingFlag
+	if flags&^allFlags != 0 || flags&(gojail.CreateFlag|gojail.UpdateFlag) == 0 {
+		return -1, &kernErr{errno: syscall.EINVAL}
+	}
+	cuflags := flags & (gojail.CreateFlag | gojail.UpdateFlag)
+	allowDying := flags&gojail.AllowDyingFlag != 0
+
+	jid, _, err := o.getInt("jid")
+	if err != nil {
+		return -1, err
+	}
+	if jid < 0 {
+		return -1, fail(syscall.EINVAL, "negative jid")
+	}
+	name, _, err := o.getString("name", nameInfo.Size)
+	if err != nil {
+		return -1, err
+	}
+	if strings.Contains(name, ".") {
+		parent := name[:strings.LastIndexByte(name, '.')]
+		return -1, fail(syscall.ENOENT, "jail \"%s\" not found", parent)
+	}
+
+	var j *jail
+	allocated := false
+	if jid != 0 {
+		j = k.jails[jid]
+		if j != nil && j.dying && !allowDying {
+			if cuflags == gojail.CreateFlag {
+				return -1, fail(syscall.EEXIST, "jail %d is dying", jid)
+			}
+			return -1, fail(syscall.ENOENT, "jail %d is dying", jid)
+		}
+	} else if name != "" {
+		j = k.findName(name, allowDying)
+	}
+
+	if j == nil {
+		if cuflags == gojail.UpdateFlag {
+			switch {
+			case jid != 0:
+				return -1, fail(syscall.ENOENT, "jail %d not found", jid)
+			case name != "":
+				return -1, fail(syscall.ENOENT, "jail \"%s\" not found", name)
+			}
+			return -1, fail(syscall.ENOENT, "update specified no jail")
+		}
+		if jid == 0 {
+			if jid = k.allocJID(); jid == 0 {
+				return -1, fail(syscall.EAGAIN, "no available jail IDs")
+			}
+			allocated = true
+		}
+		j = &jail{
+			jid:    jid,
+			values: make(map[string][]byte),
+		}
+	} else if cuflags == gojail.CreateFlag {
+		if jid != 0 {
+			return -1, fail(syscall.EEXIST, "jail %d already exists", jid)
+		}
+		return -1, fail(syscall.EEXIST, "jail \"%s\" already exists", name)
+	}
+	exists := k.jails[j.jid] == j
+
+	if name != "" && name != j.name {
+		if _, err := strconv.Atoi(name); err == nil && name != strconv.Itoa(j.jid) {
+			return -1, fail(syscall.EINVAL, "name cannot be numeric (unless it is the jid)")
+		}
+		if other := k.findName(name, false); other != nil && other != j {
+			return -1, fail(syscall.EEXIST, "jail \"%s\" already exists", name)
+		}
+	}
+
+	// Work on a copy, so a failed request leaves the jail untouched.
+	persist := j.persist
+	values := make(map[string][]byte, len(j.values))
+	for n, v := range j.values {
+		values[n] = v
+	}
+	for _, opt := range o.opts {
+		if opt.name == "jid" || opt.name == "name" {
+			continue
+		}
+		info, negated, ok := lookupParam(opt.name)
+		if !ok || info.ReadOnly {
+			return -1, fail(syscall.EINVAL, "unknown parameter: %s", opt.name)
+		}
+		if info.CreateOnly && exists {
+			return -1, fail(syscall.EINVAL, "%s cannot be changed after creation", info.Name)
+		}
+		switch info.Type {
+		case gojail.Bool:
+			if info.Name == "persist" {
+				persist = !negated
+				continue
+			}
+			values[info.Name] = encodeBool(!negated)
+		case gojail.String:
+			s, err := decodeString(opt.value, info.Size)
+			if err != nil {
+				return -1, err
+			}
+			values[info.Name] = append([]byte(s), 0)
+		default:
+			if size := fixedSize(info.Type); size > 0 && len(opt.value) != size {
+				return -1, &kernErr{errno: syscall.EINVAL}
+			} else if size == 0 && len(opt.value)%info.Size != 0 {
+				return -1, &kernErr{errno: syscall.EINVAL}
+			}
+			values[info.Name] = append([]byte(nil), opt.value...)
+		}
+	}
+	if err := k.checkAddrs(j, values, "ip4", "IPv4"); err != nil {
+		return -1, err
+	}
+	if err := k.checkAddrs(j, values, "ip6", "IPv6"); err != nil {
+		return -1, err
+	}
+
+	if name != "" {
+		j.name = name
+	} else if j.name == "" {
+		j.name = strconv.Itoa(j.jid)
+	}
+	j.persist = persist
+	j.values = values
+	j.dying = false
+	if flags&gojail.AttachFlag != 0 {
+		j.refs++
+	}
+	k.jails[j.jid] = j
+	// Like the kernel, only allocated JIDs advance the allocation.
+	if allocated {
+		k.lastjid = j.jid
+	}
+	k.reap(j)
+	return j.jid, nil
+}
+
+// Finds a live jail by name, or a dying one if allowDying is set and there
+// is no live jail of that name.
+func (k *Kernel) findName(name string, allowDying bool) *jail {
+	var dead *jail
+	for _, j := range k.jails {
+		if j.name != name {
+			continue
+		}
+		if !j.dying {
+			return j
+		}
+		if allowDying && (dead == nil || j.jid > dead.jid) {
+			dead = j
+		}
+	}
+	return dead
+}
+
+// Returns the next free JID after the last allocated one, 0 if there is
+// none.
+func (k *Kernel) allocJID() int {
+	jid := k.lastjid
+	for i := 0; i < maxJID; i++ {
+		jid++
+		if jid > maxJID {
+			jid = 1
+		}
+		if _, ok := k.jails[jid]; !ok {
+			return jid
+		}
+	}
+	return 0
+}
+
+// Checks that the addresses of the ip4.addr or ip6.addr parameter are not
+// used by another jail, including dying ones, and sets the matching
+// jailsys parameter to "new" if addresses are given.
+func (k *Kernel) checkAddrs(j *jail, values map[string][]byte, family, desc string) *kernErr {
+	addrs := values[family+".addr"]
+	if len(addrs) == 0 {
+		return nil
+	}
+	info, _ := registry.Lookup(family + ".addr")
+	size := info.Size
+	for _, other := range k.jails {
+		if other == j {
+			continue
+		}
+		oaddrs := other.values[family+".addr"]
+		for i := 0; i < len(addrs); i += size {
+			for l := 0; l < len(oaddrs); l += size {
+				if bytes.Equal(addrs[i:i+size], oaddrs[l:l+size]) {
+					return fail(syscall.EADDRINUSE, "%s addresses clash", desc)
+				}
+			}
+		}
+	}
+	values[family] = encodeInt(jailSysNew)
+	return nil
+}
+
+// Removes the jail once neither the persist flag nor any reference keeps
+// it alive.
+func (k *Kernel) reap(j *jail) {
+	if j.persist || j.refs > 0 {
+		return
+	}
+	delete(k.jails, j.jid)
+}
+
+// JailGet implements jail_get(2).
+func (k *Kernel) JailGet(iov [][]byte, flags gojail.Flags) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	o, err := parseOptions(iov)
+	if err != nil {
+		return o.fail(err)
+	}
+	jid, err := k.get(o, iov, flags)
+	if err != nil {
+		return o.fail(err)
+	}
+	return jid, nil
+}
+
+func (k *Kernel) get(o *options, iov [][]byte, flags gojail.Flags) (int, *kernErr) {
+	if flags&^gojail.AllowDyingFlag != 0 {
+		return -1, &kernErr{errno: syscall.EINVAL}
+	}
+	allowDying := flags&gojail.AllowDyingFlag != 0
+
+	var j *jail
+	if lastjid, ok, err := o.getInt("lastjid"); err != nil {
+		return -1, err
+	} else if ok {
+		jids := k.jids()
+		i := sort.SearchInts(jids, lastjid+1)
+		for ; i < len(jids); i++ {
+			if cand := k.jails[jids[i]]; !cand.dying || allowDying {
+				j = cand
+				break
+			}
+		}
+		if j == nil {
+			return -1, fail(syscall.ENOENT, "no jail after %d", lastjid)
+		}
+	} else if jid, ok, err := o.getInt("jid"); err != nil {
+		return -1, err
+	} else if ok && jid != 0 {
+		if j = k.jails[jid]; j == nil {
+			return -1, fail(syscall.ENOENT, "jail %d not found", jid)
+		}
+		if j.dying && !allowDying {
+			return -1, fail(syscall.ENOENT, "jail %d is dying", jid)
+		}
+	} else if name, ok, err := o.getString("name", 0); err != nil {
+		return -1, err
+	} else if ok && name != "" {
+		if j = k.findName(name, allowDying); j == nil {
+			if k.findName(name, true) != nil {
+				return -1, fail(syscall.ENOENT, "jail \"%s\" is dying", name)
+			}
+			return -1, fail(syscall.ENOENT, "jail \"%s\" not found", name)
+		}
+	} else {
+		return -1, fail(syscall.ENOENT, "no jail specified")
+	}
+
+	// Collect the values first, nothing is copied out on failure.
+	out := make([][]byte, len(o.opts))
+	for i, opt := range o.opts {
+		if opt.name == "lastjid" {
+			continue
+		}
+		info, negated, ok := lookupParam(opt.name)
+		if !ok {
+			return -1, fail(syscall.EINVAL, "unknown parameter: %s", opt.name)
+		}
+		var v []byte
+		switch info.Name {
+		case "jid":
+			v = encodeInt(j.jid)
+		case "name":
+			v = append([]byte(j.name), 0)
+		case "persist":
+			v = encodeBool(j.persist)
+		case "dying":
+			v = encodeBool(j.dying)
+		default:
+			var ok bool
+			if v, ok = j.values[info.Name]; !ok {
+				v = defaultValue(info)
+			}
+		}
+		if negated {
+			v = encodeBool(decodeInt(v) == 0)
+		}
+		if len(opt.value) == 0 {
+			// Empty values ask for the length, see jailparam_get(3).
+		} else if fixedSize(info.Type) > 0 {
+			if len(opt.value) != len(v) {
+				return -1, &kernErr{errno: syscall.EINVAL}
+			}
+		} else if len(opt.value) < len(v) {
+			return -1, &kernErr{errno: syscall.EINVAL}
+		}
+		out[i] = v
+	}
+	for i, opt := range o.opts {
+		if out[i] == nil {
+			continue
+		}
+		if len(opt.value) == 0 {
+			iov[opt.pos] = make([]byte, len(out[i]))
+			continue
+		}
+		n := copy(opt.value, out[i])
+		iov[opt.pos] = opt.value[:n]
+	}
+	return j.jid, nil
+}
+
+func encodeBool(b bool) []byte {
+	if b {
+		return encodeInt(1)
+	}
+	return encodeInt(0)
+}
+
+// Returns the JIDs of all jails in ascending order.
+func (k *Kernel) jids() []int {
+	jids := make([]int, 0, len(k.jails))
+	for jid := range k.jails {
+		jids = append(jids, jid)
+	}
+	sort.Ints(jids)
+	return jids
+}
+
+// Returns the jail identified by jid unless it does not exist or is dying.
+func (k *Kernel) live(jid int) (*jail, error) {
+	j := k.jails[jid]
+	if j == nil || j.dying {
+		return nil, syscall.EINVAL
+	}
+	return j, nil
+}
+
+// JailAttach implements jail_attach(2).
+// The attachment is recorded as a reference to the jail, which can be
+// dropped with Release.
+func (k *Kernel) JailAttach(jid int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	j, err := k.live(jid)
+	if err != nil {
+		return err
+	}
+	j.refs++
+	return nil
+}
+
+// JailRemove implements jail_remove(2).
+// A jail with outstanding references enters the dying state and vanishes
+// when the last one is released.
+func (k *Kernel) JailRemove(jid int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	j, err := k.live(jid)
+	if err != nil {
+		return err
+	}
+	j.persist = false
+	if j.refs > 0 {
+		j.dying = true
+	}
+	k.reap(j)
+	return nil
+}
+
+// Hold adds a reference to the jail identified by jid, like a process or
+// socket inside the jail would.
+func (k *Kernel) Hold(jid int) error {
+	return k.JailAttach(jid)
+}
+
+// Release drops a reference to the jail identified by jid, added by Hold
+// or JailAttach.
+// Jails without references are removed, unless they are persistent.
+func (k *Kernel) Release(jid int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	j := k.jails[jid]
+	if j == nil || j.refs == 0 {
+		return syscall.EINVAL
+	}
+	j.refs--
+	k.reap(j)
+	return nil
+}
@@ -0,0 +1,266 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailtest
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+
+	"purplekraken.com/pkg/gojail"
+)
+
+func param(name string, value []byte) [][]byte {
+	return [][]byte{append([]byte(name), 0), value}
+}
+
+func str(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func iovec(params ...[][]byte) [][]byte {
+	var iov [][]byte
+	for _, p := range params {
+		iov = append(iov, p...)
+	}
+	return iov
+}
+
+func errmsg(iov [][]byte) string {
+	for i := 0; i < len(iov); i += 2 {
+		if string(iov[i]) == "errmsg\x00" {
+			b := iov[i+1]
+			if n := bytes.IndexByte(b, 0); n >= 0 {
+				b = b[:n]
+			}
+			return string(b)
+		}
+	}
+	return ""
+}
+
+func create(t *testing.T, k *Kernel, name string) int {
+	t.Helper()
+	jid, err := k.JailSet(iovec(param("name", str(name)), param("persist", nil)), gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	return jid
+}
+
+func TestCreate(t *testing.T) {
+	k := NewKernel()
+	jid := create(t, k, "foo")
+	if jid != 1 {
+		t.Errorf("expected jid 1, got %d", jid)
+	}
+	if jid := create(t, k, "bar"); jid != 2 {
+		t.Errorf("expected jid 2, got %d", jid)
+	}
+
+	iov := iovec(param("name", str("foo")), param("persist", nil), param("errmsg", make([]byte, 64)))
+	if _, err := k.JailSet(iov, gojail.CreateFlag); err != syscall.EEXIST {
+		t.Errorf("expected EEXIST, got %v", err)
+	}
+	if msg := errmsg(iov); msg != `jail "foo" already exists` {
+		t.Errorf("unexpected errmsg %q", msg)
+	}
+
+	iov = iovec(param("name", str("42")), param("errmsg", make([]byte, 64)))
+	if _, err := k.JailSet(iov, gojail.CreateFlag); err != syscall.EINVAL {
+		t.Errorf("expected EINVAL for numeric name, got %v", err)
+	}
+
+	iov = iovec(param("name", str("baz")), param("allow.foo", nil), param("errmsg", make([]byte, 64)))
+	if _, err := k.JailSet(iov, gojail.CreateFlag); err != syscall.EINVAL {
+		t.Errorf("expected EINVAL, got %v", err)
+	}
+	if msg := errmsg(iov); msg != "unknown parameter: allow.foo" {
+		t.Errorf("unexpected errmsg %q", msg)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	k := NewKernel()
+	iov := iovec(param("name", str("foo")), param("errmsg", make([]byte, 64)))
+	if _, err := k.JailSet(iov, gojail.UpdateFlag); err != syscall.ENOENT {
+		t.Errorf("expected ENOENT, got %v", err)
+	}
+	if msg := errmsg(iov); msg != `jail "foo" not found` {
+		t.Errorf("unexpected errmsg %q", msg)
+	}
+
+	jid := create(t, k, "foo")
+	iov = iovec(param("name", str("foo")), param("host.hostname", str("foo.example.org")))
+	if _, err := k.JailSet(iov, gojail.CreateFlag|gojail.UpdateFlag); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	iov = iovec(param("jid", encodeInt(jid)), param("host.hostname", make([]byte, 256)))
+	if _, err := k.JailGet(iov, 0); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if s := string(iov[3]); s != "foo.example.org\x00" {
+		t.Errorf("unexpected hostname %q", s)
+	}
+
+	iov = iovec(param("jid", encodeInt(jid)), param("path", str("/jails/foo")))
+	if _, err := k.JailSet(iov, gojail.UpdateFlag); err != syscall.EINVAL {
+		t.Errorf("expected EINVAL when changing the path, got %v", err)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	k := NewKernel()
+	jid, err := k.JailSet(param("name", str("foo")), gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := k.JailGet(param("jid", encodeInt(jid)), 0); err != syscall.ENOENT {
+		t.Errorf("expected non-persistent jail to vanish, got %v", err)
+	}
+
+	jid = create(t, k, "bar")
+	if err := k.Hold(jid); err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	if _, err := k.JailSet(iovec(param("jid", encodeInt(jid)), param("nopersist", nil)), gojail.UpdateFlag); err != nil {
+		t.Fatalf("nopersist: %v", err)
+	}
+	if _, err := k.JailGet(param("jid", encodeInt(jid)), 0); err != nil {
+		t.Errorf("expected held jail to stay alive, got %v", err)
+	}
+	if err := k.Release(jid); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, err := k.JailGet(param("jid", encodeInt(jid)), 0); err != syscall.ENOENT {
+		t.Errorf("expected released jail to vanish, got %v", err)
+	}
+}
+
+func TestRemoveDying(t *testing.T) {
+	k := NewKernel()
+	jid := create(t, k, "foo")
+	if err := k.Hold(jid); err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	if err := k.JailRemove(jid); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := k.JailRemove(jid); err != syscall.EINVAL {
+		t.Errorf("expected EINVAL removing a dying jail, got %v", err)
+	}
+	iov := iovec(param("jid", encodeInt(jid)), param("errmsg", make([]byte, 64)))
+	if _, err := k.JailGet(iov, 0); err != syscall.ENOENT {
+		t.Errorf("expected ENOENT, got %v", err)
+	}
+	if msg := errmsg(iov); msg != "jail 1 is dying" {
+		t.Errorf("unexpected errmsg %q", msg)
+	}
+	iov = iovec(param("jid", encodeInt(jid)), param("dying", make([]byte, 4)))
+	if _, err := k.JailGet(iov, gojail.AllowDyingFlag); err != nil {
+		t.Fatalf("get dying: %v", err)
+	}
+	if decodeInt(iov[3]) != 1 {
+		t.Errorf("expected dying to be set")
+	}
+
+	// The name is free again, but the dying jail keeps its JID.
+	if jid := create(t, k, "foo"); jid != 2 {
+		t.Errorf("expected jid 2, got %d", jid)
+	}
+	if err := k.Release(jid); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, err := k.JailGet(param("jid", encodeInt(jid)), gojail.AllowDyingFlag); err != syscall.ENOENT {
+		t.Errorf("expected jail to be gone, got %v", err)
+	}
+}
+
+func TestJIDAllocation(t *testing.T) {
+	k := NewKernel()
+	foo := create(t, k, "foo")
+	bar := create(t, k, "bar")
+	if err := k.JailRemove(bar); err != nil {
+		t.Fatal(err)
+	}
+	// Neither updates nor explicit JIDs change the next JID.
+	if _, err := k.JailSet(iovec(param("jid", encodeInt(foo)), param("host.hostname", str("foo.example.org"))), gojail.UpdateFlag); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := k.JailSet(iovec(param("jid", encodeInt(10)), param("name", str("ten")), param("persist", nil)), gojail.CreateFlag); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if jid := create(t, k, "baz"); jid != 3 {
+		t.Errorf("expected jid 3, got %d", jid)
+	}
+}
+
+func TestLastJID(t *testing.T) {
+	k := NewKernel()
+	for _, name := range []string{"a", "b", "c"} {
+		create(t, k, name)
+	}
+	if err := k.JailRemove(2); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	var names []string
+	lastjid := 0
+	for {
+		iov := iovec(param("lastjid", encodeInt(lastjid)), param("name", make([]byte, 256)))
+		jid, err := k.JailGet(iov, 0)
+		if err == syscall.ENOENT {
+			break
+		} else if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		names = append(names, string(iov[3][:len(iov[3])-1]))
+		lastjid = jid
+	}
+	if len(names) != 2 || names[0] != "a" || names[1] != "c" {
+		t.Errorf("unexpected jails %v", names)
+	}
+}
+
+func TestAddressClash(t *testing.T) {
+	k := NewKernel()
+	addr := []byte{192, 0, 2, 1}
+	iov := iovec(param("name", str("a")), param("persist", nil), param("ip4.addr", addr))
+	jid, err := k.JailSet(iov, gojail.CreateFlag)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := k.Hold(jid); err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	if err := k.JailRemove(jid); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	iov = iovec(param("name", str("a")), param("persist", nil), param("ip4.addr", addr))
+	if _, err := k.JailSet(iov, gojail.CreateFlag); err != syscall.EADDRINUSE {
+		t.Errorf("expected EADDRINUSE while the old jail is dying, got %v", err)
+	}
+}
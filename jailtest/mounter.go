@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailtest
+
+import (
+	"sync"
+	"syscall"
+
+	"purplekraken.com/pkg/gojail/mount"
+)
+
+// Mounter is a fake mount.Mounter, which records the mounted file systems
+// instead of mounting them.
+// Mounting on a mount point twice fails with EBUSY, unmounting a directory
+// which is not a mount point with EINVAL, like the kernel does.
+// The zero value has nothing mounted.
+type Mounter struct {
+	mu      sync.Mutex
+	mounted []mount.Mount
+	// Errors returned when mounting on the given mount point.
+	Fail map[string]error
+}
+
+func (m *Mounter) find(target string) int {
+	for i, mnt := range m.mounted {
+		if mnt.Target == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// Mount records mnt.
+func (m *Mounter) Mount(mnt mount.Mount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.Fail[mnt.Target]; err != nil {
+		return err
+	}
+	if m.find(mnt.Target) >= 0 {
+		return syscall.EBUSY
+	}
+	m.mounted = append(m.mounted, mnt)
+	return nil
+}
+
+// Unmount forgets the file system mounted on target.
+func (m *Mounter) Unmount(target string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.find(target)
+	if i < 0 {
+		return syscall.EINVAL
+	}
+	m.mounted = append(m.mounted[:i], m.mounted[i+1:]...)
+	return nil
+}
+
+// Mounted returns the mounted file systems as fstab(5) entries, in the
+// order they were mounted.
+func (m *Mounter) Mounted() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var mounted []string
+	for _, mnt := range m.mounted {
+		mounted = append(mounted, mnt.String())
+	}
+	return mounted
+}
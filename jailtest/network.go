@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"syscall"
+
+	"purplekraken.com/pkg/gojail/network"
+)
+
+// Network is a fake network.Configurator, which records the aliases of
+// the interfaces.
+// Adding an alias twice fails with EEXIST, removing one which was not
+// added with EADDRNOTAVAIL, like the kernel does.
+// The zero value has no aliases.
+type Network struct {
+	mu      sync.Mutex
+	aliases map[string]network.Alias
+	// Errors returned when adding the alias given by its address, like
+	// "192.0.2.1".
+	Fail map[string]error
+}
+
+// AddAlias records a.
+func (n *Network) AddAlias(a network.Alias) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := a.IP.String()
+	if err := n.Fail[key]; err != nil {
+		return err
+	}
+	if _, ok := n.aliases[key]; ok {
+		return fmt.Errorf("add alias %s: %w", a, syscall.EEXIST)
+	}
+	if n.aliases == nil {
+		n.aliases = make(map[string]network.Alias)
+	}
+	n.aliases[key] = a
+	return nil
+}
+
+// DeleteAlias forgets a.
+func (n *Network) DeleteAlias(a network.Alias) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := a.IP.String()
+	if b, ok := n.aliases[key]; !ok || b.Interface != a.Interface {
+		return fmt.Errorf("delete alias %s: %w", a, syscall.EADDRNOTAVAIL)
+	}
+	delete(n.aliases, key)
+	return nil
+}
+
+// Aliases returns the aliases added so far as text, like
+// "em0|192.0.2.1/32", in lexical order.
+func (n *Network) Aliases() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var aliases []string
+	for _, a := range n.aliases {
+		aliases = append(aliases, a.String())
+	}
+	sort.Strings(aliases)
+	return aliases
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailtest
+
+import (
+	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/internal/endian"
+)
+
+var hostByteOrder = endian.Native
+
+const longSize = endian.LongSize
+
+// Values of the jailsys parameters, see sys/jail.h.
+const (
+	jailSysDisable = 0
+	jailSysNew     = 1
+	jailSysInherit = 2
+)
+
+// Parameters known to the fake kernel.
+var registry = gojail.StaticRegistry()
+
+// Values of a newly created jail, for all parameters not listed here the
+// zero value is reported.
+var paramDefaults = map[string]interface{}{
+	"path":               "/",
+	"securelevel":        -1,
+	"enforce_statfs":     2,
+	"osreldate":          1302001,
+	"osrelease":          "13.2-RELEASE",
+	"cpuset.id":          2,
+	"host":               jailSysNew,
+	"host.hostuuid":      "00000000-0000-0000-0000-000000000000",
+	"ip4":                jailSysDisable,
+	"ip6":                jailSysDisable,
+	"vnet":               jailSysInherit,
+	"allow.set_hostname": true,
+	"allow.suser":        true,
+	"ip4.saddrsel":       true,
+	"ip6.saddrsel":       true,
+}
+
+// Looks up the definition of a parameter.
+// Boolean parameters can also be named with a "no" prefix on the last
+// component, e.g. "nopersist" or "allow.noraw_sockets", in which case
+// negated is true and info.Name is the name of the parameter without it.
+func lookupParam(name string) (info gojail.ParamInfo, negated bool, ok bool) {
+	info, ok = registry.Lookup(name)
+	if info.Type == gojail.NoBool {
+		info.Type = gojail.Bool
+		negated = true
+	}
+	return info, negated, ok
+}
+
+// Returns the size of fixed-size values, 0 for strings and structures.
+func fixedSize(t gojail.ParamType) int {
+	switch t {
+	case gojail.Int, gojail.Uint, gojail.Bool, gojail.JailSys:
+		return 4
+	case gojail.Long, gojail.Ulong:
+		return longSize
+	}
+	return 0
+}
+
+// Encodes the default value of a parameter.
+func defaultValue(info gojail.ParamInfo) []byte {
+	v := paramDefaults[info.Name]
+	switch info.Type {
+	case gojail.Int, gojail.Uint, gojail.Bool, gojail.JailSys:
+		var i int
+		switch v := v.(type) {
+		case int:
+			i = v
+		case bool:
+			if v {
+				i = 1
+			}
+		}
+		return encodeInt(i)
+	case gojail.Long, gojail.Ulong:
+		return make([]byte, longSize)
+	case gojail.String:
+		s, _ := v.(string)
+		return append([]byte(s), 0)
+	}
+	return []byte{}
+}
+
+func encodeInt(i int) []byte {
+	b := make([]byte, 4)
+	hostByteOrder.PutUint32(b, uint32(i))
+	return b
+}
+
+func decodeInt(b []byte) int {
+	return int(int32(hostByteOrder.Uint32(b)))
+}
@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"purplekraken.com/pkg/gojail"
+)
+
+// Processes is a fake process table implementing gojail.ProcessTable.
+//
+// Processes exit as soon as they receive a signal, unless they ignore it.
+// SIGKILL cannot be ignored, but processes can be marked as unkillable to
+// model processes stuck in the kernel.
+// The zero value is an empty process table.
+type Processes struct {
+	mu      sync.Mutex
+	procs   map[int]*process
+	lastpid int
+	signals []string
+}
+
+type process struct {
+	gojail.Process
+	ignore     map[syscall.Signal]bool
+	unkillable bool
+}
+
+// Start adds a process running command to the jail jid and returns its
+// PID. The process ignores the signals in ignore.
+func (t *Processes) Start(jid int, command string, ignore ...syscall.Signal) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.procs == nil {
+		t.procs = make(map[int]*process)
+	}
+	t.lastpid++
+	p := &process{
+		Process: gojail.Process{PID: t.lastpid, JID: jid, Command: command},
+		ignore:  make(map[syscall.Signal]bool),
+	}
+	for _, sig := range ignore {
+		p.ignore[sig] = true
+	}
+	t.procs[p.PID] = p
+	return p.PID
+}
+
+// SetUnkillable marks the process pid as surviving all signals, including
+// SIGKILL.
+func (t *Processes) SetUnkillable(pid int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.procs[pid]; ok {
+		p.unkillable = true
+	}
+}
+
+// Exit removes the process pid.
+func (t *Processes) Exit(pid int) {
+	t.mu.Lock()
+	delete(t.procs, pid)
+	t.mu.Unlock()
+}
+
+// Processes returns the processes of the jail jid, ordered by PID.
+func (t *Processes) Processes(jid int) ([]gojail.Process, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var procs []gojail.Process
+	for _, p := range t.procs {
+		if p.JID == jid {
+			procs = append(procs, p.Process)
+		}
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+	return procs, nil
+}
+
+// Signal records the signal and ends the process pid unless it ignores
+// sig.
+func (t *Processes) Signal(pid int, sig syscall.Signal) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.procs[pid]
+	if !ok {
+		return syscall.ESRCH
+	}
+	t.signals = append(t.signals, fmt.Sprintf("%d: %s", pid, unix.SignalName(sig)))
+	if p.unkillable || (p.ignore[sig] && sig != syscall.SIGKILL) {
+		return nil
+	}
+	delete(t.procs, pid)
+	return nil
+}
+
+// Signals returns the signals sent so far, formatted as "<PID>: <signal>",
+// like "12: SIGTERM".
+func (t *Processes) Signals() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.signals...)
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package jailtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"purplekraken.com/pkg/gojail/lifecycle"
+)
+
+// Runner is a fake lifecycle.Runner, which records the commands instead
+// of running them.
+type Runner struct {
+	mu       sync.Mutex
+	commands []*lifecycle.Command
+	// Errors returned for the commands of a step, like "exec.start".
+	Fail map[string]error
+	// If not nil, called for every command after it was recorded, the
+	// error is returned from Run.
+	Hook func(ctx context.Context, cmd *lifecycle.Command) error
+}
+
+// Run records cmd.
+func (r *Runner) Run(ctx context.Context, cmd *lifecycle.Command) error {
+	r.mu.Lock()
+	r.commands = append(r.commands, cmd)
+	err := r.Fail[cmd.Step]
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if r.Hook != nil {
+		return r.Hook(ctx, cmd)
+	}
+	return ctx.Err()
+}
+
+// Commands returns the commands run so far.
+func (r *Runner) Commands() []*lifecycle.Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*lifecycle.Command(nil), r.commands...)
+}
+
+// Log returns the commands run so far as text, prefixed with "host:" or
+// "jail <JID>:".
+func (r *Runner) Log() []string {
+	var log []string
+	for _, cmd := range r.Commands() {
+		where := "host"
+		if cmd.JID != 0 {
+			where = fmt.Sprintf("jail %d", cmd.JID)
+		}
+		log = append(log, where+": "+cmd.String())
+	}
+	return log
+}
+
+// Reset forgets the commands run so far.
+func (r *Runner) Reset() {
+	r.mu.Lock()
+	r.commands = nil
+	r.mu.Unlock()
+}
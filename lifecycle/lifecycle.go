@@ -0,0 +1,569 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package lifecycle starts and stops jails defined in jail.conf(5) the way
+// jail(8) does, including interface aliases, mounts and the exec.*
+// commands.
+//
+// All commands go through a Runner, so the sequence of steps can be
+// tested with a fake runner and the fake kernel of the jailtest package.
+package lifecycle // import "purplekraken.com/pkg/gojail/lifecycle"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/jailconf"
+	"purplekraken.com/pkg/gojail/mount"
+	"purplekraken.com/pkg/gojail/network"
+)
+
+// Paths of the programs run by the Manager.
+const (
+	shell        = "/bin/sh"
+	ifconfigPath = "/sbin/ifconfig"
+	mountPath    = "/sbin/mount"
+	umountPath   = "/sbin/umount"
+)
+
+const defaultStopTimeout = 10 * time.Second
+
+// Manager starts and stops jails.
+//
+// Starting a jail runs the following steps, stopping at the first failure
+// and undoing the steps which were completed:
+//
+//  1. exec.prepare commands on the host
+//  2. adding the interface aliases for ip4.addr and ip6.addr
+//  3. mounting mount.fstab, mount, mount.devfs, mount.fdescfs and
+//     mount.procfs
+//  4. exec.prestart commands on the host
+//  5. creating the jail
+//  6. moving the vnet.interface interfaces into the jail and creating its
+//     epairs
+//  7. exec.created commands on the host
+//  8. exec.start commands and the command parameter in the jail
+//  9. exec.poststart commands on the host
+//
+// Unless the jail has the persist parameter, it is created persistent and
+// the parameter is cleared after the last step, so the jail goes away
+// once its processes exit.
+//
+// Stopping a jail runs exec.prestop on the host and exec.stop in the jail,
+// terminates the processes of the jail, moves the vnet.interface
+// interfaces back, destroys the epairs, removes the jail, and runs
+// exec.poststop on the host. Then the file systems are unmounted and the aliases
+// removed in reverse order, and finally exec.release runs on the host.
+// Stopping continues after failed steps and returns the first error.
+//
+// Commands from exec.* parameters are run with /bin/sh -c, and limited to
+// exec.timeout seconds. Commands in the jail run as exec.jail_user, looked
+// up on the host if exec.system_jail_user is set; commands on the host run
+// as exec.system_user. With exec.clean, both run in a clean environment,
+// the login environment of their user.
+type Manager struct {
+	Runner Runner
+	// Terminate asks the processes of the jail jid to exit, and waits at
+	// most timeout for them. The processes left are killed when the jail
+	// is removed.
+	// If nil, gojail.Terminate sends SIGTERM to the processes listed by
+	// Processes and waits for them.
+	// Terminate is not called if stop.timeout is 0.
+	Terminate func(ctx context.Context, jid int, timeout time.Duration) error
+	// Processes is the process table used if Terminate is nil, defaults to
+	// gojail.SystemProcesses.
+	Processes gojail.ProcessTable
+	// Network adds and removes the interface aliases. If nil, they are
+	// managed by running ifconfig(8) on the host.
+	Network network.Configurator
+	// Mounts mounts and unmounts the file systems of the jail. If nil,
+	// they are managed by running mount(8) and umount(8) on the host,
+	// with the same checks of the mount points.
+	Mounts *mount.Manager
+	// VNET creates the epairs returned by Epairs for the jail after
+	// creating it, and destroys them when the jail is stopped. No epairs
+	// are created if either is nil.
+	// The epairs are only known to the Manager which started the jail.
+	VNET   *network.VNET
+	Epairs func(j *jailconf.Jail) []network.Epair
+
+	mu     sync.Mutex
+	epairs map[string][]network.Epair // by jail name
+}
+
+var persistName = []byte("persist\x00")
+
+// Settings of a jail, taken from its parameters.
+type settings struct {
+	j              *jailconf.Jail
+	path           string
+	execTimeout    time.Duration
+	stopTimeout    time.Duration
+	jailUser       string
+	systemJailUser bool
+	systemUser     string
+	clean          bool
+}
+
+// Returns the first value of the parameter name.
+func first(j *jailconf.Jail, name string) (string, bool) {
+	values, ok := j.Values[name]
+	if !ok || len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// Reports whether the boolean parameter name is set, either by name only
+// or to true.
+func isSet(j *jailconf.Jail, name string) bool {
+	values, ok := j.Values[name]
+	if !ok {
+		return false
+	}
+	if len(values) == 0 || values[0] == "" {
+		return true
+	}
+	b, err := strconv.ParseBool(values[0])
+	return err == nil && b
+}
+
+// Returns the value of the parameter name in seconds.
+func seconds(j *jailconf.Jail, name string, def time.Duration) (time.Duration, error) {
+	s, ok := first(j, name)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: %s: invalid number of seconds %q", j.Name, name, s)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+func newSettings(j *jailconf.Jail) (*settings, error) {
+	s := &settings{
+		j:              j,
+		systemJailUser: isSet(j, "exec.system_jail_user"),
+		clean:          isSet(j, "exec.clean"),
+	}
+	s.path, _ = first(j, "path")
+	s.jailUser, _ = first(j, "exec.jail_user")
+	s.systemUser, _ = first(j, "exec.system_user")
+	var err error
+	if s.execTimeout, err = seconds(j, "exec.timeout", 0); err != nil {
+		return nil, err
+	}
+	if s.stopTimeout, err = seconds(j, "stop.timeout", defaultStopTimeout); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Runs cmd, limited to exec.timeout.
+func (m *Manager) run(ctx context.Context, s *settings, cmd *Command) error {
+	if s.execTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.execTimeout)
+		defer cancel()
+	}
+	if err := m.Runner.Run(ctx, cmd); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v", s.execTimeout)
+		}
+		return fmt.Errorf("%s: %s: %s: %w", s.j.Name, cmd.Step, cmd, err)
+	}
+	return nil
+}
+
+// Runs the commands of the parameter step, in the jail jid or on the host
+// if jid is 0.
+func (m *Manager) runStep(ctx context.Context, s *settings, step string, jid int) error {
+	for _, line := range s.j.Values[step] {
+		cmd := &Command{Step: step, JID: jid, Args: []string{shell, "-c", line}}
+		if jid != 0 {
+			cmd.User = s.jailUser
+			cmd.SystemUser = s.systemJailUser
+		} else {
+			cmd.User = s.systemUser
+		}
+		cmd.Clean = s.clean
+		if err := m.run(ctx, s, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A resource set up on the host before the jail is created.
+type resource struct {
+	up   *Command
+	down *Command
+	// Called before up, if not nil.
+	check func() error
+}
+
+func hostCommand(step string, args ...string) *Command {
+	return &Command{Step: step, Args: args}
+}
+
+// Returns the interface aliases of the jail, none for VNET jails.
+func aliases(j *jailconf.Jail) ([]network.Alias, error) {
+	if v, _ := first(j, "vnet"); v == "new" {
+		return nil, nil
+	}
+	iface, _ := first(j, "interface")
+	var res []network.Alias
+	for _, name := range []string{"ip4.addr", "ip6.addr"} {
+		for _, v := range j.Values[name] {
+			a, err := network.ParseAlias(v, iface)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", j.Name, name, err)
+			}
+			if a.Interface != "" {
+				res = append(res, a)
+			}
+		}
+	}
+	return res, nil
+}
+
+// Returns the ifconfig(8) commands adding and removing the aliases.
+func aliasCommands(aliases []network.Alias) []resource {
+	var res []resource
+	for _, a := range aliases {
+		step, af := "ip4.addr", "inet"
+		up := []string{ifconfigPath, a.Interface, af, a.IP.String() + "/" + strconv.Itoa(a.Prefix())}
+		if a.Is6() {
+			step, af = "ip6.addr", "inet6"
+			up = []string{ifconfigPath, a.Interface, af, a.IP.String(), "prefixlen", strconv.Itoa(a.Prefix())}
+		}
+		res = append(res, resource{
+			up:   hostCommand(step, append(up, "alias")...),
+			down: hostCommand(step, ifconfigPath, a.Interface, af, a.IP.String(), "-alias"),
+		})
+	}
+	return res
+}
+
+// Returns the mount(8) and umount(8) commands for the file systems of
+// the jail, in the order of mount.Plan and with its checks of the mount
+// points.
+func mounts(s *settings) ([]resource, error) {
+	plan, err := mount.Plan(s.j)
+	if err != nil {
+		return nil, err
+	}
+	var res []resource
+	for _, mnt := range plan {
+		up := []string{mountPath, "-t", mnt.FSType}
+		if len(mnt.Options) > 0 {
+			up = append(up, "-o", strings.Join(mnt.Options, ","))
+		}
+		mnt := mnt
+		res = append(res, resource{
+			up:   hostCommand(mnt.Step, append(up, mnt.Source, mnt.Target)...),
+			down: hostCommand(mnt.Step, umountPath, mnt.Target),
+			// The mounts before can change the directories leading to
+			// the mount point.
+			check: func() error {
+				if err := mount.Check(s.path, mnt.Target); err != nil {
+					return fmt.Errorf("%s: %s: %w", s.j.Name, mnt.Step, err)
+				}
+				return nil
+			},
+		})
+	}
+	return res, nil
+}
+
+// Start starts the jail j and returns its JID.
+func (m *Manager) Start(ctx context.Context, j *jailconf.Jail) (jid int, err error) {
+	s, err := newSettings(j)
+	if err != nil {
+		return 0, err
+	}
+	mnts, err := mounts(s)
+	if err != nil {
+		return 0, err
+	}
+	addrs, err := aliases(j)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := gojail.GetId(j.Name); err == nil {
+		return 0, fmt.Errorf("%s: %w", j.Name, gojail.ErrExists)
+	} else if !errors.Is(err, gojail.ErrNotFound) {
+		return 0, err
+	}
+
+	var undo []func()
+	defer func() {
+		if err != nil {
+			for i := len(undo) - 1; i >= 0; i-- {
+				undo[i]()
+			}
+		}
+	}()
+	setUp := func(res []resource) error {
+		for _, r := range res {
+			if r.check != nil {
+				if err := r.check(); err != nil {
+					return err
+				}
+			}
+			if err := m.run(ctx, s, r.up); err != nil {
+				return err
+			}
+			down := r.down
+			undo = append(undo, func() { m.run(context.Background(), s, down) })
+		}
+		return nil
+	}
+
+	if err := m.runStep(ctx, s, "exec.prepare", 0); err != nil {
+		return 0, err
+	}
+	if m.Network != nil {
+		if err := network.AddAliases(m.Network, addrs); err != nil {
+			return 0, fmt.Errorf("%s: %w", j.Name, err)
+		}
+		undo = append(undo, func() { network.DeleteAliases(m.Network, addrs) })
+	} else if err := setUp(aliasCommands(addrs)); err != nil {
+		return 0, err
+	}
+	if m.Mounts != nil {
+		if _, err := m.Mounts.Mount(j); err != nil {
+			return 0, err
+		}
+		undo = append(undo, func() { m.Mounts.Unmount(j) })
+	} else if err := setUp(mnts); err != nil {
+		return 0, err
+	}
+	if err := m.runStep(ctx, s, "exec.prestart", 0); err != nil {
+		return 0, err
+	}
+
+	params := j.Params
+	persist := isSet(j, "persist")
+	if !persist {
+		params = nil
+		for _, p := range j.Params {
+			if !bytes.Equal(p.Name(), persistName) {
+				params = append(params, p)
+			}
+		}
+		p, err := gojail.NewStringParam("persist", "")
+		if err != nil {
+			return 0, err
+		}
+		params = append(params, p)
+	}
+	if jid, err = gojail.SetParams(params, gojail.CreateFlag); err != nil {
+		return 0, fmt.Errorf("%s: %w", j.Name, err)
+	}
+	created := jid
+	undo = append(undo, func() { gojail.Remove(created) })
+
+	for _, iface := range j.Values["vnet.interface"] {
+		cmd := hostCommand("vnet.interface", ifconfigPath, iface, "vnet", strconv.Itoa(jid))
+		if err := m.run(ctx, s, cmd); err != nil {
+			return 0, err
+		}
+	}
+	if m.VNET != nil && m.Epairs != nil {
+		if epairs := m.Epairs(j); len(epairs) > 0 {
+			epairs, err := m.VNET.Provision(jid, epairs)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", j.Name, err)
+			}
+			m.setEpairs(j.Name, epairs)
+			undo = append(undo, func() {
+				m.VNET.Release(epairs)
+				m.setEpairs(j.Name, nil)
+			})
+		}
+	}
+	if err := m.runStep(ctx, s, "exec.created", 0); err != nil {
+		return 0, err
+	}
+	if err := m.runStep(ctx, s, "exec.start", jid); err != nil {
+		return 0, err
+	}
+	if args := j.Values["command"]; len(args) > 0 {
+		cmd := &Command{
+			Step:       "command",
+			JID:        jid,
+			Args:       args,
+			User:       s.jailUser,
+			SystemUser: s.systemJailUser,
+			Clean:      s.clean,
+		}
+		if err := m.run(ctx, s, cmd); err != nil {
+			return 0, err
+		}
+	}
+	if err := m.runStep(ctx, s, "exec.poststart", 0); err != nil {
+		return 0, err
+	}
+
+	if !persist {
+		if err := clearPersist(jid); err != nil {
+			return 0, fmt.Errorf("%s: %w", j.Name, err)
+		}
+	}
+	return jid, nil
+}
+
+// Records the epairs provisioned for the jail name, or forgets them if
+// epairs is nil.
+func (m *Manager) setEpairs(name string, epairs []network.Epair) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if epairs == nil {
+		delete(m.epairs, name)
+		return
+	}
+	if m.epairs == nil {
+		m.epairs = make(map[string][]network.Epair)
+	}
+	m.epairs[name] = epairs
+}
+
+func (m *Manager) getEpairs(name string) []network.Epair {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.epairs[name]
+}
+
+// Clears the persist parameter of the jail jid, which removes the jail if
+// it has no processes.
+func clearPersist(jid int) error {
+	key, err := gojail.NewIntParam("jid", jid)
+	if err != nil {
+		return err
+	}
+	nopersist, err := gojail.Import("persist", "false")
+	if err != nil {
+		return err
+	}
+	_, err = gojail.SetParams([]gojail.JailParam{key, nopersist}, gojail.UpdateFlag)
+	return err
+}
+
+// Stop stops the jail j.
+func (m *Manager) Stop(ctx context.Context, j *jailconf.Jail) error {
+	s, err := newSettings(j)
+	if err != nil {
+		return err
+	}
+	mnts, err := mounts(s)
+	if err != nil {
+		return err
+	}
+	addrs, err := aliases(j)
+	if err != nil {
+		return err
+	}
+	jid, err := gojail.GetId(j.Name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", j.Name, err)
+	}
+
+	var first error
+	keep := func(err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	keep(m.runStep(ctx, s, "exec.prestop", 0))
+	keep(m.runStep(ctx, s, "exec.stop", jid))
+	if s.stopTimeout > 0 {
+		keep(m.terminate(ctx, s, jid))
+	}
+	for _, iface := range j.Values["vnet.interface"] {
+		keep(m.run(ctx, s, hostCommand("vnet.interface", ifconfigPath, iface, "-vnet", strconv.Itoa(jid))))
+	}
+	if epairs := m.getEpairs(j.Name); len(epairs) > 0 {
+		if err := m.VNET.Release(epairs); err != nil {
+			keep(fmt.Errorf("%s: %w", j.Name, err))
+		}
+		m.setEpairs(j.Name, nil)
+	}
+	if err := gojail.Remove(jid); err != nil && !errors.Is(err, gojail.ErrNotFound) {
+		keep(fmt.Errorf("%s: %w", j.Name, err))
+	}
+	keep(m.runStep(ctx, s, "exec.poststop", 0))
+	if m.Mounts != nil {
+		_, err := m.Mounts.Unmount(j)
+		keep(err)
+	} else {
+		for i := len(mnts) - 1; i >= 0; i-- {
+			keep(m.run(ctx, s, mnts[i].down))
+		}
+	}
+	if m.Network != nil {
+		if err := network.DeleteAliases(m.Network, addrs); err != nil {
+			keep(fmt.Errorf("%s: %w", j.Name, err))
+		}
+	} else {
+		res := aliasCommands(addrs)
+		for i := len(res) - 1; i >= 0; i-- {
+			keep(m.run(ctx, s, res[i].down))
+		}
+	}
+	keep(m.runStep(ctx, s, "exec.release", 0))
+	return first
+}
+
+func (m *Manager) terminate(ctx context.Context, s *settings, jid int) error {
+	var err error
+	if m.Terminate != nil {
+		err = m.Terminate(ctx, jid, s.stopTimeout)
+	} else {
+		// The processes left are killed when the jail is removed.
+		_, err = gojail.Terminate(ctx, jid, s.stopTimeout, m.Processes)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: stop.timeout: %w", s.j.Name, err)
+	}
+	return nil
+}
+
+// Restart stops the jail j and starts it again.
+func (m *Manager) Restart(ctx context.Context, j *jailconf.Jail) (int, error) {
+	if err := m.Stop(ctx, j); err != nil {
+		return 0, err
+	}
+	return m.Start(ctx, j)
+}
@@ -0,0 +1,390 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/jailconf"
+	"purplekraken.com/pkg/gojail/jailtest"
+	"purplekraken.com/pkg/gojail/lifecycle"
+	"purplekraken.com/pkg/gojail/mount"
+	"purplekraken.com/pkg/gojail/network"
+)
+
+const testConf = `
+path = "/jails/$name";
+host.hostname = "$name.example.org";
+exec.prepare = "echo prepare";
+exec.prestart = "echo prestart";
+exec.created = "echo created";
+exec.start = "/bin/sh /etc/rc";
+exec.poststart = "echo poststart";
+exec.prestop = "echo prestop";
+exec.stop = "/bin/sh /etc/rc.shutdown";
+exec.poststop = "echo poststop";
+exec.release = "echo release";
+exec.jail_user = www;
+exec.system_user = admin;
+exec.clean;
+exec.timeout = 30;
+stop.timeout = 5;
+
+www {
+	persist;
+	ip4.addr = em0|192.0.2.1/24, 192.0.2.2;
+	ip6.addr = lo0|2001:db8::1;
+	mount = "/data /jails/www/data nullfs ro";
+	mount.devfs;
+	mount.procfs;
+}
+
+temp {
+	exec.start = "/usr/local/bin/job";
+	exec.start += "echo done";
+}
+`
+
+func setup(t *testing.T) (*jailconf.Config, *jailtest.Kernel, *jailtest.Runner, *lifecycle.Manager) {
+	k := jailtest.NewKernel()
+	prev := gojail.SetBackend(k)
+	t.Cleanup(func() { gojail.SetBackend(prev) })
+	f, err := jailconf.Parse("jail.conf", []byte(testConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := jailconf.Resolve(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &jailtest.Runner{}
+	return c, k, r, &lifecycle.Manager{Runner: r, Processes: &jailtest.Processes{}}
+}
+
+func jail(t *testing.T, c *jailconf.Config, name string) *jailconf.Jail {
+	j, err := c.Jail(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func checkLog(t *testing.T, r *jailtest.Runner, want []string) {
+	t.Helper()
+	if got := r.Log(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected commands\n\t%s\ngot\n\t%s", strings.Join(want, "\n\t"), strings.Join(got, "\n\t"))
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	c, _, r, m := setup(t)
+	ctx := context.Background()
+	www := jail(t, c, "www")
+	var terminated time.Duration
+	m.Terminate = func(ctx context.Context, jid int, timeout time.Duration) error {
+		terminated = timeout
+		return nil
+	}
+	jid, err := m.Start(ctx, www)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	checkLog(t, r, []string{
+		"host: /bin/sh -c echo prepare",
+		"host: /sbin/ifconfig em0 inet 192.0.2.1/24 alias",
+		"host: /sbin/ifconfig lo0 inet6 2001:db8::1 prefixlen 128 alias",
+		"host: /sbin/mount -t nullfs -o ro /data /jails/www/data",
+		"host: /sbin/mount -t devfs -o ruleset=4 devfs /jails/www/dev",
+		"host: /sbin/mount -t procfs proc /jails/www/proc",
+		"host: /bin/sh -c echo prestart",
+		"host: /bin/sh -c echo created",
+		"jail 1: /bin/sh -c /bin/sh /etc/rc",
+		"host: /bin/sh -c echo poststart",
+	})
+	for _, cmd := range r.Commands() {
+		if cmd.JID != 0 && (cmd.User != "www" || !cmd.Clean || cmd.SystemUser) {
+			t.Errorf("unexpected settings of jail command %+v", cmd)
+		}
+		if cmd.Step == "exec.prestart" && (cmd.User != "admin" || !cmd.Clean) {
+			t.Errorf("expected clean host command as exec.system_user, got %+v", cmd)
+		}
+		if cmd.Step == "mount.devfs" && cmd.User != "" {
+			t.Errorf("expected mount as the current user, got %+v", cmd)
+		}
+	}
+	if id, err := gojail.GetId("www"); err != nil || id != jid {
+		t.Errorf("expected jail www with JID %d, got %d (%v)", jid, id, err)
+	}
+	if _, err := m.Start(ctx, www); !errors.Is(err, gojail.ErrExists) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+
+	r.Reset()
+	if err := m.Stop(ctx, www); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	checkLog(t, r, []string{
+		"host: /bin/sh -c echo prestop",
+		"jail 1: /bin/sh -c /bin/sh /etc/rc.shutdown",
+		"host: /bin/sh -c echo poststop",
+		"host: /sbin/umount /jails/www/proc",
+		"host: /sbin/umount /jails/www/dev",
+		"host: /sbin/umount /jails/www/data",
+		"host: /sbin/ifconfig lo0 inet6 2001:db8::1 -alias",
+		"host: /sbin/ifconfig em0 inet 192.0.2.1 -alias",
+		"host: /bin/sh -c echo release",
+	})
+	if terminated != 5*time.Second {
+		t.Errorf("expected stop.timeout of 5s, got %v", terminated)
+	}
+	if _, err := gojail.GetId("www"); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected jail to be removed, got %v", err)
+	}
+	if err := m.Stop(ctx, www); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	c, _, _, m := setup(t)
+	procs := &jailtest.Processes{}
+	m.Processes = procs
+	ctx := context.Background()
+	www := jail(t, c, "www")
+	www.Values["stop.timeout"] = []string{"1"}
+	jid, err := m.Start(ctx, www)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	procs.Start(jid, "httpd")
+	procs.Start(jid, "stuck", syscall.SIGTERM)
+	start := time.Now()
+	if err := m.Stop(ctx, www); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("expected to wait for stop.timeout, stopped after %v", d)
+	}
+	want := []string{"1: SIGTERM", "2: SIGTERM"}
+	if got := procs.Signals(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected signals %q, got %q", want, got)
+	}
+	if _, err := gojail.GetId("www"); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected jail to be removed, got %v", err)
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	c, _, r, m := setup(t)
+	r.Fail = map[string]error{"exec.start": errors.New("exit status 1")}
+	_, err := m.Start(context.Background(), jail(t, c, "www"))
+	if err == nil || !strings.Contains(err.Error(), "www: exec.start: /bin/sh -c /bin/sh /etc/rc: exit status 1") {
+		t.Fatalf("expected exec.start to fail, got %v", err)
+	}
+	log := r.Log()
+	checkLog(t, r, append(log[:9:9],
+		"host: /sbin/umount /jails/www/proc",
+		"host: /sbin/umount /jails/www/dev",
+		"host: /sbin/umount /jails/www/data",
+		"host: /sbin/ifconfig lo0 inet6 2001:db8::1 -alias",
+		"host: /sbin/ifconfig em0 inet 192.0.2.1 -alias",
+	))
+	if _, err := gojail.GetId("www"); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected jail to be removed, got %v", err)
+	}
+}
+
+func TestNonPersistent(t *testing.T) {
+	c, _, r, m := setup(t)
+	var deadlines []bool
+	r.Hook = func(ctx context.Context, cmd *lifecycle.Command) error {
+		_, ok := ctx.Deadline()
+		deadlines = append(deadlines, ok)
+		if cmd.JID != 0 {
+			// The jail is kept while its commands run.
+			if _, err := gojail.GetId("temp"); err != nil {
+				t.Errorf("expected jail during %s, got %v", cmd.Step, err)
+			}
+		}
+		return nil
+	}
+	temp := jail(t, c, "temp")
+	if _, err := m.Start(context.Background(), temp); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if got := r.Log()[3:5]; got[0] != "jail 1: /bin/sh -c /usr/local/bin/job" || got[1] != "jail 1: /bin/sh -c echo done" {
+		t.Errorf("unexpected exec.start commands %v", got)
+	}
+	for i, ok := range deadlines {
+		if !ok {
+			t.Errorf("expected exec.timeout for command %d", i)
+		}
+	}
+	// Without processes, the jail is gone once persist is cleared.
+	if _, err := gojail.GetId("temp"); !errors.Is(err, gojail.ErrNotFound) {
+		t.Errorf("expected jail to be gone, got %v", err)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	c, _, r, m := setup(t)
+	n := &jailtest.Network{}
+	m.Network = n
+	ctx := context.Background()
+	www := jail(t, c, "www")
+	if _, err := m.Start(ctx, www); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	want := []string{"em0|192.0.2.1/24", "lo0|2001:db8::1/128"}
+	if got := n.Aliases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected aliases %q, got %q", want, got)
+	}
+	for _, line := range r.Log() {
+		if strings.Contains(line, "ifconfig") {
+			t.Errorf("unexpected command %q", line)
+		}
+	}
+	if err := m.Stop(ctx, www); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got := n.Aliases(); len(got) != 0 {
+		t.Errorf("expected aliases to be removed, got %q", got)
+	}
+
+	// Failing to add the second alias removes the first one again.
+	n.Fail = map[string]error{"2001:db8::1": errors.New("no such interface")}
+	if _, err := m.Start(ctx, www); err == nil || !strings.Contains(err.Error(), "no such interface") {
+		t.Errorf("expected adding the alias to fail, got %v", err)
+	}
+	if got := n.Aliases(); len(got) != 0 {
+		t.Errorf("expected aliases to be rolled back, got %q", got)
+	}
+}
+
+func TestMounts(t *testing.T) {
+	c, _, r, m := setup(t)
+	mounter := &jailtest.Mounter{}
+	m.Mounts = &mount.Manager{Mounter: mounter}
+	ctx := context.Background()
+	www := jail(t, c, "www")
+	if _, err := m.Start(ctx, www); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	want := []string{
+		"/data /jails/www/data nullfs ro",
+		"devfs /jails/www/dev devfs ruleset=4",
+		"proc /jails/www/proc procfs rw",
+	}
+	if got := mounter.Mounted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected mounts %q, got %q", want, got)
+	}
+	for _, line := range r.Log() {
+		if strings.Contains(line, "mount") {
+			t.Errorf("unexpected command %q", line)
+		}
+	}
+	if err := m.Stop(ctx, www); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got := mounter.Mounted(); len(got) != 0 {
+		t.Errorf("expected file systems to be unmounted, got %q", got)
+	}
+}
+
+func TestMountEscape(t *testing.T) {
+	c, _, r, m := setup(t)
+	ctx := context.Background()
+	www := jail(t, c, "www")
+	www.Values["mount"] = []string{"/data /jails/www/../etc nullfs ro"}
+	if _, err := m.Start(ctx, www); !errors.Is(err, mount.ErrEscape) {
+		t.Errorf("expected ErrEscape, got %v", err)
+	}
+
+	root := t.TempDir()
+	if err := os.Symlink("/etc", filepath.Join(root, "data")); err != nil {
+		t.Fatal(err)
+	}
+	www.Values["path"] = []string{root}
+	www.Values["mount"] = []string{"/data " + root + "/data/x nullfs ro"}
+	if _, err := m.Start(ctx, www); !errors.Is(err, mount.ErrEscape) {
+		t.Errorf("expected ErrEscape for a symbolic link, got %v", err)
+	}
+	for _, line := range r.Log() {
+		if strings.Contains(line, "mount") {
+			t.Errorf("unexpected command %q", line)
+		}
+	}
+}
+
+func TestVNET(t *testing.T) {
+	c, _, r, m := setup(t)
+	ifs := &jailtest.Interfaces{}
+	ifs.AddBridge("bridge0")
+	m.VNET = &network.VNET{Interfaces: ifs}
+	m.Epairs = func(j *jailconf.Jail) []network.Epair {
+		return []network.Epair{{Bridge: "bridge0", Name: "eth0"}}
+	}
+	ctx := context.Background()
+	www := jail(t, c, "www")
+	jid, err := m.Start(ctx, www)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	want := []string{
+		"0/bridge0 members=epair0a",
+		"0/epair0a up",
+		fmt.Sprintf("%d/eth0 up", jid),
+	}
+	if got := ifs.Interfaces(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected interfaces %q, got %q", want, got)
+	}
+	if err := m.Stop(ctx, www); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got := ifs.Interfaces(); !reflect.DeepEqual(got, []string{"0/bridge0"}) {
+		t.Errorf("expected epairs to be destroyed, got %q", got)
+	}
+
+	// The epairs are destroyed if starting the jail fails later on.
+	r.Fail = map[string]error{"exec.start": errors.New("exit status 1")}
+	if _, err := m.Start(ctx, www); err == nil {
+		t.Fatal("expected exec.start to fail")
+	}
+	if got := ifs.Interfaces(); !reflect.DeepEqual(got, []string{"0/bridge0"}) {
+		t.Errorf("expected epairs to be rolled back, got %q", got)
+	}
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// Command is a command run while starting or stopping a jail.
+type Command struct {
+	// The parameter the command comes from, like "exec.start", or the
+	// step for commands run by the Manager itself, like "mount.devfs".
+	Step string
+	// The jail to run the command in, 0 to run it on the host.
+	JID int
+	// The program and its arguments.
+	Args []string
+	// The user to run the command as, empty for the current user.
+	User string
+	// Set if User is looked up on the host instead of in the jail.
+	SystemUser bool
+	// Set if the command runs in a clean environment, like a login
+	// shell of User, or of the current user for host commands without
+	// User.
+	Clean bool
+}
+
+func (c *Command) String() string {
+	return strings.Join(c.Args, " ")
+}
+
+// Runner runs the commands of the Manager.
+// Run returns after the command terminated, or when ctx is done.
+type Runner interface {
+	Run(ctx context.Context, cmd *Command) error
+}
+
+// ExecRunner runs commands as child processes, using jexec(8) to run
+// commands in jails and su(1) to run commands on the host as another user
+// or in a clean environment.
+type ExecRunner struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Paths of the programs run by ExecRunner.
+const (
+	jexecPath = "/usr/sbin/jexec"
+	suPath    = "/usr/bin/su"
+)
+
+// Run runs cmd and waits for it.
+func (r *ExecRunner) Run(ctx context.Context, cmd *Command) error {
+	args := cmd.Args
+	switch {
+	case cmd.JID != 0:
+		jexec := []string{jexecPath}
+		if cmd.Clean {
+			jexec = append(jexec, "-l")
+		}
+		if cmd.User != "" {
+			if cmd.SystemUser {
+				jexec = append(jexec, "-u", cmd.User)
+			} else {
+				jexec = append(jexec, "-U", cmd.User)
+			}
+		}
+		args = append(append(jexec, strconv.Itoa(cmd.JID)), args...)
+	case cmd.User != "" || cmd.Clean:
+		name := cmd.User
+		if name == "" {
+			u, err := user.Current()
+			if err != nil {
+				return err
+			}
+			name = u.Username
+		}
+		su := []string{suPath, "-m"}
+		if cmd.Clean {
+			su[1] = "-l"
+		}
+		args = append(su, name, "-c", shellQuote(args))
+	}
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Stdout = r.Stdout
+	c.Stderr = r.Stderr
+	if cmd.Clean {
+		// Like jail(8), only TERM is passed on to the login environment.
+		c.Env = []string{}
+		if term, ok := os.LookupEnv("TERM"); ok {
+			c.Env = append(c.Env, "TERM="+term)
+		}
+	}
+	return c.Run()
+}
+
+// Returns args as a shell command line, quoting arguments as needed.
+func shellQuote(args []string) string {
+	if len(args) == 3 && args[0] == shell && args[1] == "-c" {
+		return args[2]
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
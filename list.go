@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import "errors"
+
+// JailInfo describes a jail found by List or an Iterator.
+type JailInfo struct {
+	JID      int
+	Name     string
+	Path     string
+	Hostname string
+	Parent   int  // JID of the parent jail, 0 for the host
+	Dying    bool // Only reported if AllowDyingFlag was given
+}
+
+// Iterator walks all jails visible to the process in ascending order of
+// their JIDs, using the "lastjid" parameter of jail_get(2).
+//
+//	it := gojail.NewIterator(0)
+//	for it.Next() {
+//		fmt.Println(it.Jail().Name)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	flags   Flags
+	lastjid int
+	info    JailInfo
+	err     error
+	done    bool
+}
+
+// NewIterator returns an iterator over all jails.
+// Dying jails are skipped, unless flags contains AllowDyingFlag.
+func NewIterator(flags Flags) *Iterator {
+	return &Iterator{
+		flags: flags & AllowDyingFlag,
+	}
+}
+
+// Next advances the iterator to the next jail and reports whether there is
+// one.
+// When Next returns false, Err reports whether the iteration ended because
+// of an error.
+func (it *Iterator) Next() bool {
+	if it.done {
+		return false
+	}
+	var iov [12][]byte
+	iov[0] = byteSliceFromStringOrDie("lastjid")
+	iov[1] = intToBytes(it.lastjid)
+	iov[2] = byteSliceFromStringOrDie("name")
+	iov[3] = make([]byte, maxnamelen)
+	iov[4] = byteSliceFromStringOrDie("path")
+	iov[5] = make([]byte, maxpathlen)
+	iov[6] = byteSliceFromStringOrDie("host.hostname")
+	iov[7] = make([]byte, maxnamelen)
+	iov[8] = byteSliceFromStringOrDie("parent")
+	iov[9] = make([]byte, 4)
+	iov[10] = byteSliceFromStringOrDie("dying")
+	iov[11] = make([]byte, 4)
+	jid, err := callWithErrmsg("jail_get", iov[:], it.flags, func(iov [][]byte) (int, error) {
+		return backend.JailGet(iov, it.flags)
+	})
+	if err != nil {
+		it.done = true
+		// With lastjid, ENOENT means there is no jail with a higher
+		// JID, which is the regular end of the iteration.
+		if !errors.Is(err, ErrNotFound) {
+			it.err = err
+		}
+		return false
+	}
+	it.lastjid = jid
+	it.info = JailInfo{
+		JID:      jid,
+		Name:     cstring(iov[3]),
+		Path:     cstring(iov[5]),
+		Hostname: cstring(iov[7]),
+		Parent:   bytesToInt(iov[9]),
+		Dying:    bytesToInt(iov[11]) != 0,
+	}
+	return true
+}
+
+// Jail returns the jail the iterator currently points to.
+func (it *Iterator) Jail() JailInfo {
+	return it.info
+}
+
+// Err returns the error that ended the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// List returns all jails visible to the process, ordered by JID.
+// Dying jails are included if flags contains AllowDyingFlag.
+func List(flags Flags) ([]JailInfo, error) {
+	var jails []JailInfo
+	it := NewIterator(flags)
+	for it.Next() {
+		jails = append(jails, it.Jail())
+	}
+	return jails, it.Err()
+}
@@ -0,0 +1,379 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ipType       = reflect.TypeOf(net.IP(nil))
+	unknownType  = reflect.TypeOf(map[string]string(nil))
+	paramTagName = "jail"
+)
+
+// Options of a struct field tag.
+type tagOptions struct {
+	omitempty bool
+	boolean   bool
+	unknown   bool
+}
+
+// A struct field mapped to a parameter.
+type paramField struct {
+	name  string
+	opts  tagOptions
+	value reflect.Value
+}
+
+// Collects the fields of the struct rv, recursing into nested structs.
+// Nested structs prefix the names of their fields with their own name and
+// a dot, unless their name is empty.
+func structFields(rv reflect.Value, prefix string, fields []paramField) ([]paramField, error) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag, ok := sf.Tag.Lookup(paramTagName)
+		if !ok || tag == "-" || sf.PkgPath != "" {
+			continue
+		}
+		var opts tagOptions
+		parts := strings.Split(tag, ",")
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "omitempty":
+				opts.omitempty = true
+			case "bool":
+				opts.boolean = true
+			case "unknown":
+				opts.unknown = true
+			default:
+				return nil, invalidParamError("field %s: unknown tag option %s", sf.Name, opt)
+			}
+		}
+		fv := rv.Field(i)
+		name := parts[0]
+		if opts.unknown {
+			if sf.Type != unknownType {
+				return nil, invalidParamError("field %s: unknown parameters need a map[string]string", sf.Name)
+			}
+		} else if sf.Type.Kind() == reflect.Struct {
+			p := prefix
+			if name != "" {
+				p += name + "."
+			}
+			var err error
+			if fields, err = structFields(fv, p, fields); err != nil {
+				return nil, err
+			}
+			continue
+		} else if name == "" {
+			return nil, invalidParamError("field %s: missing parameter name", sf.Name)
+		}
+		if name != "" {
+			name = prefix + name
+		}
+		fields = append(fields, paramField{name: name, opts: opts, value: fv})
+	}
+	return fields, nil
+}
+
+// Returns the fields of the struct v points to.
+func structFieldsOf(v interface{}) ([]paramField, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, invalidParamError("expected a pointer to a struct, got %T", v)
+	}
+	return structFields(rv.Elem(), "", nil)
+}
+
+// Marshal returns the parameters described by the struct v, or the struct
+// v points to.
+//
+// Fields are mapped to parameters by their "jail" tags, holding the name of
+// the parameter and optionally a list of options:
+//
+//	type Config struct {
+//		Name     string   `jail:"name"`
+//		Hostname string   `jail:"host.hostname,omitempty"`
+//		Addrs    []net.IP `jail:"ip4.addr"`
+//		Allow    struct {
+//			RawSockets bool `jail:"raw_sockets"`
+//		} `jail:"allow"`
+//		Other map[string]string `jail:",unknown"`
+//	}
+//
+// Nested structs prefix the names of their fields with their own name and a
+// dot, fields without a tag are ignored.
+// Fields can be strings, booleans, integers, net.IP, []net.IP and
+// []string; they are converted to the text format of Import, and the
+// parameter type is taken from the default registry.
+// The option "bool" marks a boolean parameter unknown to the registry, the
+// field can then be a bool or an integer.
+// Fields with the option "omitempty" are skipped if they have their zero
+// value.
+// The map of the field with the option "unknown" holds additional
+// parameters in text form, which Unmarshal fills with the parameters not
+// matching any field.
+func Marshal(v interface{}) ([]JailParam, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, invalidParamError("expected a struct, got %T", v)
+	}
+	fields, err := structFields(rv, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var params []JailParam
+	for _, f := range fields {
+		if f.opts.unknown {
+			extra := f.value.Interface().(map[string]string)
+			names := make([]string, 0, len(extra))
+			for name := range extra {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				p, err := Import(name, extra[name])
+				if err != nil {
+					return nil, err
+				}
+				params = append(params, p)
+			}
+			continue
+		}
+		if f.opts.omitempty && f.value.IsZero() {
+			continue
+		}
+		text, err := fieldText(f.value)
+		if err != nil {
+			return nil, invalidParamError("%s: %v", f.name, err)
+		}
+		var p JailParam
+		if f.opts.boolean {
+			var b bool
+			if b, err = strconv.ParseBool(text); err == nil {
+				p, err = newBoolParam(ParamInfo{Name: f.name, Type: Bool}, b)
+			}
+		} else {
+			p, err = Import(f.name, text)
+		}
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// Formats the value of a field in the text format of Import.
+func fieldText(v reflect.Value) (string, error) {
+	if v.Type() == ipType {
+		if len(v.Bytes()) == 0 {
+			return "", nil
+		}
+		return v.Interface().(net.IP).String(), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Slice:
+		elems := make([]string, v.Len())
+		for i := range elems {
+			s, err := fieldText(v.Index(i))
+			if err != nil {
+				return "", err
+			}
+			elems[i] = s
+		}
+		return strings.Join(elems, ","), nil
+	}
+	return "", invalidParamError("unsupported type %s", v.Type())
+}
+
+// Sets the field v to the value given in the text format of Export.
+func setField(v reflect.Value, text string) error {
+	if v.Type() == ipType {
+		if text == "" {
+			v.SetBytes(nil)
+			return nil
+		}
+		ip := net.ParseIP(text)
+		if ip == nil {
+			return invalidParamError("invalid IP address %s", text)
+		}
+		v.Set(reflect.ValueOf(ip))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Booleans stored in integer fields.
+		switch text {
+		case "false":
+			text = "0"
+		case "true":
+			text = "1"
+		}
+		i, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Slice:
+		var elems []string
+		if text != "" {
+			elems = strings.Split(text, ",")
+		}
+		s := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for i, elem := range elems {
+			if err := setField(s.Index(i), elem); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	default:
+		return invalidParamError("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Unmarshal stores the values of params in the struct v points to, using
+// the mapping described for Marshal.
+// Parameters without a matching field are stored in the field with the
+// "unknown" option, or ignored if there is none.
+func Unmarshal(params []JailParam, v interface{}) error {
+	fields, err := structFieldsOf(v)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]paramField, len(fields))
+	var unknown reflect.Value
+	for _, f := range fields {
+		if f.opts.unknown {
+			unknown = f.value
+		} else {
+			byName[f.name] = f
+		}
+	}
+	for _, p := range params {
+		name := cstring(p.Name())
+		if name == "errmsg" || p.Data() == nil {
+			continue
+		}
+		text, err := Export(p)
+		if err != nil {
+			return err
+		}
+		f, ok := byName[name]
+		if !ok {
+			if unknown.IsValid() {
+				if unknown.IsNil() {
+					unknown.Set(reflect.MakeMap(unknownType))
+				}
+				unknown.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(text))
+			}
+			continue
+		}
+		if err := setField(f.value, text); err != nil {
+			return invalidParamError("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// OutParams returns output parameters for all fields of the struct v
+// points to, to be passed to GetParams and then to Unmarshal.
+func OutParams(v interface{}) ([]JailParam, error) {
+	fields, err := structFieldsOf(v)
+	if err != nil {
+		return nil, err
+	}
+	var params []JailParam
+	for _, f := range fields {
+		if f.opts.unknown {
+			continue
+		}
+		var p *OutParam
+		if _, known := LookupParam(f.name); f.opts.boolean && !known {
+			nameb, err := unix.ByteSliceFromString(f.name)
+			if err != nil {
+				return nil, err
+			}
+			p = &OutParam{
+				name: nameb,
+				info: ParamInfo{Name: f.name, Type: Bool},
+				buf:  make([]byte, 4),
+			}
+		} else if p, err = Want(f.name); err != nil {
+			return nil, err
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// ParamsInto reads the parameters described by the struct v points to and
+// stores their values in it, see Marshal for the mapping.
+func (j *Jail) ParamsInto(v interface{}) error {
+	params, err := OutParams(v)
+	if err != nil {
+		return err
+	}
+	if err := j.Params(params...); err != nil {
+		return err
+	}
+	return Unmarshal(params, v)
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package mount
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIovec(t *testing.T) {
+	m := Mount{
+		Source:  "/data",
+		Target:  "/jails/www/data",
+		FSType:  "nullfs",
+		Options: []string{"ro", "late", "failok", "noauto", "userquota=/quota", "groupquota", "mountprog=/sbin/mount_x", "size=1g"},
+	}
+	var got []string
+	iov := iovec(m)
+	for i := 0; i < len(iov); i += 2 {
+		got = append(got, cstring(iov[i])+"="+cstring(iov[i+1]))
+	}
+	want := []string{
+		"fstype=nullfs",
+		"fspath=/jails/www/data",
+		"from=/data",
+		"ro=",
+		"size=1g",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected nmount options %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,362 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package mount mounts the file systems of jails defined in jail.conf(5),
+// like jail(8) does for the mount.fstab, mount, mount.devfs,
+// mount.fdescfs and mount.procfs parameters.
+//
+// All mount points must be inside the root directory of the jail, given by
+// its path parameter. Mount points leaving it through ".." or symbolic
+// links are refused, since the contents of the jail are under the control
+// of its users.
+package mount // import "purplekraken.com/pkg/gojail/mount"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"purplekraken.com/pkg/gojail/fstab"
+	"purplekraken.com/pkg/gojail/jailconf"
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+const defaultDevfsRuleset = 4 // devfsrules_jail in /etc/defaults/devfs.rules
+
+// ErrEscape is returned for mount points outside the root directory of
+// the jail.
+var ErrEscape = errors.New("mount point escapes the jail root")
+
+// Mount is a file system to mount for a jail.
+type Mount struct {
+	Source  string   // Device or directory, like "/data" for nullfs or "devfs"
+	Target  string   // Mount point on the host
+	FSType  string   // Type of the file system, like "nullfs"
+	Options []string // Mount options, like "ro" or "ruleset=4"
+	Step    string   // Parameter the mount comes from, like "mount.devfs"
+}
+
+// String returns the mount as an fstab(5) entry, without the dump and
+// pass fields.
+func (m Mount) String() string {
+	opts := "rw"
+	if len(m.Options) > 0 {
+		opts = strings.Join(m.Options, ",")
+	}
+	return strings.Join([]string{fstab.Escape(m.Source), fstab.Escape(m.Target), m.FSType, opts}, " ")
+}
+
+// Plan returns the file systems to mount for the jail j, in the order
+// jail(8) mounts them: the entries of the mount.fstab files and of the
+// mount parameter, then devfs, fdescfs and procfs, if mount.devfs,
+// mount.fdescfs and mount.procfs are set.
+// Entries with the noauto option are skipped.
+// The mount points are checked against the root directory of the jail,
+// see Check.
+func Plan(j *jailconf.Jail) ([]Mount, error) {
+	root, err := rootOf(j)
+	if err != nil {
+		return nil, err
+	}
+	var plan []Mount
+	for _, path := range j.Values["mount.fstab"] {
+		f, err := fstab.ParseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: mount.fstab: %w", j.Name, err)
+		}
+		for _, e := range f.Entries() {
+			if _, noauto := e.Option("noauto"); !noauto {
+				plan = append(plan, FromEntry(e, "mount.fstab"))
+			}
+		}
+	}
+	for _, line := range j.Values["mount"] {
+		e, err := fstab.ParseEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: mount: %q: %w", j.Name, line, err)
+		}
+		if _, noauto := e.Option("noauto"); !noauto {
+			plan = append(plan, FromEntry(e, "mount"))
+		}
+	}
+	if isSet(j, "mount.devfs") {
+		ruleset := strconv.Itoa(defaultDevfsRuleset)
+		if v := j.Values["devfs_ruleset"]; len(v) > 0 {
+			ruleset = v[0]
+		}
+		plan = append(plan, Mount{
+			Source:  "devfs",
+			Target:  filepath.Join(root, "dev"),
+			FSType:  "devfs",
+			Options: []string{"ruleset=" + ruleset},
+			Step:    "mount.devfs",
+		})
+	}
+	if isSet(j, "mount.fdescfs") {
+		plan = append(plan, Mount{Source: "fdesc", Target: filepath.Join(root, "dev/fd"), FSType: "fdescfs", Step: "mount.fdescfs"})
+	}
+	if isSet(j, "mount.procfs") {
+		plan = append(plan, Mount{Source: "proc", Target: filepath.Join(root, "proc"), FSType: "procfs", Step: "mount.procfs"})
+	}
+	if len(plan) > 0 && root == "" {
+		return nil, fmt.Errorf("%s: %s: path is not set", j.Name, plan[0].Step)
+	}
+	for _, m := range plan {
+		if err := Check(root, m.Target); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", j.Name, m.Step, err)
+		}
+	}
+	return plan, nil
+}
+
+// Returns the path parameter of j, cleaned.
+func rootOf(j *jailconf.Jail) (string, error) {
+	v := j.Values["path"]
+	if len(v) == 0 || v[0] == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(v[0]) {
+		return "", fmt.Errorf("%s: path is not absolute: %s", j.Name, v[0])
+	}
+	return filepath.Clean(v[0]), nil
+}
+
+// Reports whether the boolean parameter name is set, either by name only
+// or to true.
+func isSet(j *jailconf.Jail, name string) bool {
+	values, ok := j.Values[name]
+	if !ok {
+		return false
+	}
+	if len(values) == 0 || values[0] == "" {
+		return true
+	}
+	b, err := strconv.ParseBool(values[0])
+	return err == nil && b
+}
+
+// FromEntry returns the mount described by the fstab entry e, which comes
+// from the parameter step.
+// The "rw" option is dropped, since it is the default.
+func FromEntry(e *fstab.Entry, step string) Mount {
+	m := Mount{Source: e.Source, Target: e.Target, FSType: e.Type, Step: step}
+	for _, opt := range e.Options {
+		if opt != "rw" {
+			m.Options = append(m.Options, opt)
+		}
+	}
+	return m
+}
+
+// Check reports an error matching ErrEscape if target is not inside the
+// directory root, after resolving "." and ".." elements, or if one of the
+// directories leading to it below root is a symbolic link.
+// Directories which do not exist yet are not checked.
+func Check(root, target string) error {
+	if !filepath.IsAbs(target) {
+		return fmt.Errorf("mount point is not absolute: %s", target)
+	}
+	target = filepath.Clean(target)
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return fmt.Errorf("%s: %w %s", target, ErrEscape, root)
+	}
+	if rel == "." {
+		return nil
+	}
+	path := root
+	for _, elem := range strings.Split(rel, "/") {
+		path = filepath.Join(path, elem)
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: %w %s through the symbolic link %s", target, ErrEscape, root, path)
+		}
+	}
+	return nil
+}
+
+// Mounter mounts and unmounts file systems.
+type Mounter interface {
+	Mount(m Mount) error
+	Unmount(target string) error
+}
+
+// System mounts file systems with nmount(2) and unmount(2).
+// Options only interpreted by mount(8), like late and failok, are left
+// out, since the kernel rejects them.
+// On systems other than FreeBSD, it fails with ENOSYS.
+var System Mounter = sysMounter{}
+
+type sysMounter struct{}
+
+const errmsglen = 255
+
+// Options interpreted by mount(8) itself, which it does not pass to
+// nmount(2).
+var userlandOptions = map[string]bool{
+	"failok":     true,
+	"groupquota": true,
+	"late":       true,
+	"mountprog":  true,
+	"noauto":     true,
+	"userquota":  true,
+}
+
+// Returns the name and value pairs for nmount(2) for the mount m, without
+// the errmsg.
+func iovec(m Mount) [][]byte {
+	iov := [][]byte{
+		cstr("fstype"), cstr(m.FSType),
+		cstr("fspath"), cstr(m.Target),
+		cstr("from"), cstr(m.Source),
+	}
+	for _, opt := range m.Options {
+		name, value := opt, ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			name, value = opt[:i], opt[i+1:]
+		}
+		if name == "" || userlandOptions[name] {
+			continue
+		}
+		if value == "" {
+			// Flags are passed without a value.
+			iov = append(iov, cstr(name), nil)
+		} else {
+			iov = append(iov, cstr(name), cstr(value))
+		}
+	}
+	return iov
+}
+
+func (sysMounter) Mount(m Mount) error {
+	iov := iovec(m)
+	errmsg := make([]byte, errmsglen)
+	iov = append(iov, cstr("errmsg"), errmsg)
+	if err := syscall.Nmount(iov, 0); err != nil {
+		err = os.NewSyscallError("nmount", err)
+		if errmsg[0] != 0 {
+			return fmt.Errorf("mount %s: %s: %w", m.Target, cstring(errmsg), err)
+		}
+		return fmt.Errorf("mount %s: %w", m.Target, err)
+	}
+	return nil
+}
+
+func (sysMounter) Unmount(target string) error {
+	if err := syscall.Unmount(target, 0); err != nil {
+		return fmt.Errorf("unmount %s: %w", target, os.NewSyscallError("unmount", err))
+	}
+	return nil
+}
+
+// Returns s with a terminating NUL byte.
+func cstr(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// Returns the string up to the first NUL byte in b.
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// Manager mounts and unmounts the file systems of jails.
+type Manager struct {
+	// Mounter defaults to System.
+	Mounter Mounter
+	// If set, Mount and Unmount only return the plan, without mounting
+	// or unmounting anything.
+	DryRun bool
+}
+
+func (m *Manager) mounter() Mounter {
+	if m.Mounter == nil {
+		return System
+	}
+	return m.Mounter
+}
+
+// Mount mounts the file systems of the jail j in the order of Plan, and
+// returns the plan.
+// Each mount point is checked again right before it is mounted, since the
+// mounts before can change the directories leading to it.
+// If a mount fails, the file systems mounted before are unmounted again.
+func (m *Manager) Mount(j *jailconf.Jail) ([]Mount, error) {
+	plan, err := Plan(j)
+	if err != nil || m.DryRun {
+		return plan, err
+	}
+	root, _ := rootOf(j)
+	mounter := m.mounter()
+	for i, mnt := range plan {
+		err := Check(root, mnt.Target)
+		if err == nil {
+			err = mounter.Mount(mnt)
+		}
+		if err != nil {
+			for k := i - 1; k >= 0; k-- {
+				mounter.Unmount(plan[k].Target)
+			}
+			return plan, fmt.Errorf("%s: %s: %w", j.Name, mnt.Step, err)
+		}
+	}
+	return plan, nil
+}
+
+// Unmount unmounts the file systems of the jail j in the reverse order of
+// Plan, and returns them in that order.
+// It continues after failures and returns the first error.
+func (m *Manager) Unmount(j *jailconf.Jail) ([]Mount, error) {
+	plan, err := Plan(j)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := 0, len(plan)-1; i < k; i, k = i+1, k-1 {
+		plan[i], plan[k] = plan[k], plan[i]
+	}
+	if m.DryRun {
+		return plan, nil
+	}
+	mounter := m.mounter()
+	var first error
+	for _, mnt := range plan {
+		if err := mounter.Unmount(mnt.Target); err != nil && first == nil {
+			first = fmt.Errorf("%s: %s: %w", j.Name, mnt.Step, err)
+		}
+	}
+	return plan, first
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package mount_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"purplekraken.com/pkg/gojail/jailconf"
+	"purplekraken.com/pkg/gojail/jailtest"
+	"purplekraken.com/pkg/gojail/mount"
+)
+
+// Returns the jail www defined by conf, with $root replaced by root.
+func jail(t *testing.T, root, conf string) *jailconf.Jail {
+	t.Helper()
+	conf = strings.ReplaceAll(conf, "$root", root)
+	f, err := jailconf.Parse("jail.conf", []byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := jailconf.Resolve(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.Jail("www")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func entries(plan []mount.Mount) []string {
+	var lines []string
+	for _, m := range plan {
+		lines = append(lines, m.String())
+	}
+	return lines
+}
+
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "www")
+	for _, d := range []string{"data", "dev", "tmp", "proc"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fstab := filepath.Join(dir, "fstab")
+	src := "# Data\n/data $root/data nullfs ro 0 0\n\ntmpfs $root/tmp tmpfs rw,size=1g\n/cd $root/cd cd9660 ro,noauto\n"
+	if err := os.WriteFile(fstab, []byte(strings.ReplaceAll(src, "$root", root)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j := jail(t, root, `www {
+	path = "$root";
+	mount.fstab = "`+fstab+`";
+	mount = "/usr/ports $root/usr/ports nullfs ro";
+	mount.devfs;
+	devfs_ruleset = 10;
+	mount.fdescfs;
+	mount.procfs;
+}`)
+
+	m := &mount.Manager{Mounter: &jailtest.Mounter{}, DryRun: true}
+	plan, err := m.Mount(j)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	want := []string{
+		"/data " + root + "/data nullfs ro",
+		"tmpfs " + root + "/tmp tmpfs size=1g",
+		"/usr/ports " + root + "/usr/ports nullfs ro",
+		"devfs " + root + "/dev devfs ruleset=10",
+		"fdesc " + root + "/dev/fd fdescfs rw",
+		"proc " + root + "/proc procfs rw",
+	}
+	if got := entries(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected plan\n\t%s\ngot\n\t%s", strings.Join(want, "\n\t"), strings.Join(got, "\n\t"))
+	}
+	if got := m.Mounter.(*jailtest.Mounter).Mounted(); len(got) != 0 {
+		t.Errorf("dry run mounted %q", got)
+	}
+
+	mounter := &jailtest.Mounter{}
+	m = &mount.Manager{Mounter: mounter}
+	if _, err := m.Mount(j); err != nil {
+		t.Fatalf("mount: %v", err)
+	}
+	if got := mounter.Mounted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected mounts %q, got %q", want, got)
+	}
+	plan, err = m.Unmount(j)
+	if err != nil {
+		t.Fatalf("unmount: %v", err)
+	}
+	if got := plan[0].Target; got != root+"/proc" {
+		t.Errorf("expected procfs to be unmounted first, got %s", got)
+	}
+	if got := mounter.Mounted(); len(got) != 0 {
+		t.Errorf("expected everything to be unmounted, got %q", got)
+	}
+
+	// A failed mount unmounts the file systems mounted before.
+	fail := errors.New("fail")
+	mounter.Fail = map[string]error{root + "/dev": fail}
+	if _, err := m.Mount(j); !errors.Is(err, fail) {
+		t.Errorf("expected failure, got %v", err)
+	}
+	if got := mounter.Mounted(); len(got) != 0 {
+		t.Errorf("expected rollback, got %q", got)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "www")
+	if err := os.MkdirAll(filepath.Join(root, "usr"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc", filepath.Join(root, "usr/local")); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"/data $root/../other nullfs ro",
+		"/data $root/usr/local/data nullfs ro",
+		"/data /data nullfs ro",
+		"/data data nullfs ro",
+	} {
+		j := jail(t, root, `www { path = "$root"; mount = "`+line+`"; }`)
+		_, err := mount.Plan(j)
+		if err == nil || (!errors.Is(err, mount.ErrEscape) && !strings.Contains(err.Error(), "not absolute")) {
+			t.Errorf("%s: expected escape to be refused, got %v", line, err)
+		}
+	}
+	if err := mount.Check(root, root+"/usr/../usr/share"); err != nil {
+		t.Errorf("expected path inside the root to be accepted, got %v", err)
+	}
+
+	j := jail(t, root, `www { mount.devfs; }`)
+	if _, err := mount.Plan(j); err == nil || !strings.Contains(err.Error(), "path is not set") {
+		t.Errorf("expected missing path to be reported, got %v", err)
+	}
+}
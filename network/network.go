@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package network adds and removes the interface addresses of jails.
+//
+// A jail can only use the addresses of its ip4.addr and ip6.addr
+// parameters if they are assigned to an interface of the host. jail(8)
+// adds them as aliases when the jail is created, to the interface given in
+// the "interface|address/prefix" form of the parameters or by the
+// interface parameter, and removes them again with the jail.
+//
+// Creating and removing jails with gojail.Create and gojail.Remove does not
+// touch the addresses, like jail_set(2) and jail_remove(2). The
+// lifecycle package adds and removes them as part of starting and stopping
+// jails; other callers use AddAliases before creating a jail and
+// DeleteAliases after removing it.
+package network // import "purplekraken.com/pkg/gojail/network"
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+// Alias is an address assigned to a network interface in addition to its
+// primary address.
+type Alias struct {
+	Interface string
+	IP        net.IP
+	Mask      net.IPMask
+}
+
+// ParseAlias parses an address in the form accepted by jail(8) for the
+// ip4.addr and ip6.addr parameters, "interface|address/mask".
+// The interface defaults to iface, the mask is a prefix length or, for
+// IPv4, a netmask like 255.255.255.0, and defaults to a single address.
+// If neither s nor iface name an interface, the Interface of the alias is
+// empty and the address is not meant to be added to any.
+func ParseAlias(s, iface string) (Alias, error) {
+	text := strings.TrimSpace(s)
+	if i := strings.IndexByte(text, '|'); i >= 0 {
+		iface, text = text[:i], text[i+1:]
+	}
+	addr, mask := text, ""
+	if i := strings.IndexByte(text, '/'); i >= 0 {
+		addr, mask = text[:i], text[i+1:]
+	}
+	a := Alias{Interface: iface, IP: net.ParseIP(addr)}
+	if a.IP == nil {
+		return Alias{}, fmt.Errorf("invalid address %q", s)
+	}
+	bits := net.IPv6len * 8
+	if ip4 := a.IP.To4(); ip4 != nil && !strings.Contains(addr, ":") {
+		a.IP = ip4
+		bits = net.IPv4len * 8
+	}
+	if mask == "" {
+		a.Mask = net.CIDRMask(bits, bits)
+	} else if n, err := strconv.Atoi(mask); err == nil && n >= 0 && n <= bits {
+		a.Mask = net.CIDRMask(n, bits)
+	} else if m := net.ParseIP(mask).To4(); m != nil && bits == 32 && isCanonical(net.IPMask(m)) {
+		a.Mask = net.IPMask(m)
+	} else {
+		return Alias{}, fmt.Errorf("invalid netmask in %q", s)
+	}
+	return a, nil
+}
+
+// Reports whether the mask consists of leading ones.
+func isCanonical(m net.IPMask) bool {
+	_, bits := m.Size()
+	return bits != 0
+}
+
+// Is6 reports whether the alias is an IPv6 address.
+func (a Alias) Is6() bool {
+	return len(a.IP) == net.IPv6len
+}
+
+// Prefix returns the prefix length of the mask.
+func (a Alias) Prefix() int {
+	ones, _ := a.Mask.Size()
+	return ones
+}
+
+// String returns the alias in the form accepted by ParseAlias.
+func (a Alias) String() string {
+	s := a.IP.String() + "/" + strconv.Itoa(a.Prefix())
+	if a.Interface != "" {
+		s = a.Interface + "|" + s
+	}
+	return s
+}
+
+// Configurator adds and removes interface aliases.
+type Configurator interface {
+	AddAlias(a Alias) error
+	DeleteAlias(a Alias) error
+}
+
+// System configures the interfaces of the running kernel with the
+// SIOCAIFADDR and SIOCDIFADDR ioctls and their IPv6 equivalents, like
+// ifconfig(8).
+// On systems other than FreeBSD, it fails with ENOSYS.
+var System Configurator = sysConfigurator{}
+
+type sysConfigurator struct{}
+
+func (sysConfigurator) AddAlias(a Alias) error {
+	var err error
+	if a.Is6() {
+		var addr, mask [16]byte
+		copy(addr[:], a.IP)
+		copy(mask[:], a.Mask)
+		err = syscall.AddInet6Alias(a.Interface, addr, mask)
+	} else {
+		var addr, mask [4]byte
+		copy(addr[:], a.IP)
+		copy(mask[:], a.Mask)
+		err = syscall.AddInetAlias(a.Interface, addr, mask)
+	}
+	if err != nil {
+		return fmt.Errorf("add alias %s: %w", a, os.NewSyscallError("ioctl", err))
+	}
+	return nil
+}
+
+func (sysConfigurator) DeleteAlias(a Alias) error {
+	var err error
+	if a.Is6() {
+		var addr [16]byte
+		copy(addr[:], a.IP)
+		err = syscall.DeleteInet6Alias(a.Interface, addr)
+	} else {
+		var addr [4]byte
+		copy(addr[:], a.IP)
+		err = syscall.DeleteInetAlias(a.Interface, addr)
+	}
+	if err != nil {
+		return fmt.Errorf("delete alias %s: %w", a, os.NewSyscallError("ioctl", err))
+	}
+	return nil
+}
+
+// AddAliases adds the aliases in order, skipping the ones without an
+// interface. If adding one fails, the aliases added before are removed
+// again, so either all aliases are added or none.
+func AddAliases(c Configurator, aliases []Alias) error {
+	for i, a := range aliases {
+		if a.Interface == "" {
+			continue
+		}
+		if err := c.AddAlias(a); err != nil {
+			DeleteAliases(c, aliases[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAliases removes the aliases in reverse order, skipping the ones
+// without an interface. It continues after failures and returns the first
+// error.
+func DeleteAliases(c Configurator, aliases []Alias) error {
+	var first error
+	for i := len(aliases) - 1; i >= 0; i-- {
+		a := aliases[i]
+		if a.Interface == "" {
+			continue
+		}
+		if err := c.DeleteAlias(a); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package network_test
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"purplekraken.com/pkg/gojail/jailtest"
+	"purplekraken.com/pkg/gojail/network"
+)
+
+func TestParseAlias(t *testing.T) {
+	tests := []struct {
+		s, iface string
+		want     string
+	}{
+		{"192.0.2.1", "", "192.0.2.1/32"},
+		{"192.0.2.1", "em0", "em0|192.0.2.1/32"},
+		{"lo1|192.0.2.1/24", "em0", "lo1|192.0.2.1/24"},
+		{"em0|192.0.2.1/255.255.255.0", "", "em0|192.0.2.1/24"},
+		{" em0|2001:db8::1 ", "", "em0|2001:db8::1/128"},
+		{"em0|2001:db8::1/64", "", "em0|2001:db8::1/64"},
+	}
+	for _, test := range tests {
+		a, err := network.ParseAlias(test.s, test.iface)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if got := a.String(); got != test.want {
+			t.Errorf("%q: got %q, expected %q", test.s, got, test.want)
+		}
+	}
+	for _, s := range []string{"", "em0|", "192.0.2.256", "192.0.2.1/33", "192.0.2.1/255.0.255.0", "2001:db8::1/255.255.255.0"} {
+		if a, err := network.ParseAlias(s, "em0"); err == nil {
+			t.Errorf("%q: expected error, got %v", s, a)
+		}
+	}
+}
+
+func aliases(t *testing.T, specs ...string) []network.Alias {
+	var res []network.Alias
+	for _, s := range specs {
+		a, err := network.ParseAlias(s, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+func TestAddAliases(t *testing.T) {
+	n := &jailtest.Network{}
+	as := aliases(t, "em0|192.0.2.1", "192.0.2.2", "em0|2001:db8::1/64")
+	if err := network.AddAliases(n, as); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"em0|192.0.2.1/32", "em0|2001:db8::1/64"}
+	if got := n.Aliases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got aliases %q, expected %q", got, want)
+	}
+	if err := network.AddAliases(n, as[:1]); !errors.Is(err, syscall.EEXIST) {
+		t.Errorf("expected EEXIST, got %v", err)
+	}
+	if err := network.DeleteAliases(n, as); err != nil {
+		t.Fatal(err)
+	}
+	if err := network.DeleteAliases(n, as); !errors.Is(err, syscall.EADDRNOTAVAIL) {
+		t.Errorf("expected EADDRNOTAVAIL, got %v", err)
+	}
+
+	fail := errors.New("fail")
+	n.Fail = map[string]error{"2001:db8::1": fail}
+	if err := network.AddAliases(n, as); err != fail {
+		t.Errorf("expected failure, got %v", err)
+	}
+	if got := n.Aliases(); len(got) != 0 {
+		t.Errorf("expected rollback, got aliases %q", got)
+	}
+}
+
+func TestSystem(t *testing.T) {
+	if runtime.GOOS == "freebsd" {
+		t.Skip("would change the interfaces of the host")
+	}
+	a := aliases(t, "lo0|192.0.2.1")[0]
+	if err := network.System.AddAlias(a); !errors.Is(err, syscall.ENOSYS) {
+		t.Errorf("expected ENOSYS, got %v", err)
+	}
+}
+
+func TestVNET(t *testing.T) {
+	ifs := &jailtest.Interfaces{}
+	ifs.AddBridge("bridge0")
+	v := &network.VNET{Interfaces: ifs}
+	epairs, err := v.Provision(3, []network.Epair{
+		{Bridge: "bridge0", Name: "eth0"},
+		{},
+	})
+	if err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+	want := []string{
+		"0/bridge0 members=epair0a",
+		"0/epair0a up",
+		"0/epair1a up",
+		"3/epair1b up",
+		"3/eth0 up",
+	}
+	if got := ifs.Interfaces(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected interfaces\n\t%q\ngot\n\t%q", want, got)
+	}
+	wantLog := []string{
+		"CreateEpair epair",
+		"AddToBridge bridge0 epair0a",
+		"SetUp epair0a",
+		"MoveToJail epair0b",
+		"Rename epair0b eth0",
+		"SetUp eth0",
+	}
+	if got := ifs.Log()[:6]; !reflect.DeepEqual(got, wantLog) {
+		t.Errorf("expected operations %q, got %q", wantLog, got)
+	}
+	if epairs[0].Host != "epair0a" || epairs[0].Jail != "eth0" || epairs[1].Jail != "epair1b" {
+		t.Errorf("unexpected epairs %+v", epairs)
+	}
+
+	if err := v.Release(epairs); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if got := ifs.Interfaces(); !reflect.DeepEqual(got, []string{"0/bridge0"}) {
+		t.Errorf("expected only the bridge to be left, got %q", got)
+	}
+}
+
+func TestVNETRollback(t *testing.T) {
+	ifs := &jailtest.Interfaces{}
+	ifs.AddBridge("bridge0")
+	fail := errors.New("fail")
+	ifs.Fail = map[string]error{"SetUp eth1": fail}
+	v := &network.VNET{Interfaces: ifs}
+	_, err := v.Provision(3, []network.Epair{
+		{Bridge: "bridge0", Name: "eth0"},
+		{Bridge: "bridge0", Name: "eth1"},
+	})
+	if err != fail {
+		t.Fatalf("expected failure, got %v", err)
+	}
+	if got := ifs.Interfaces(); !reflect.DeepEqual(got, []string{"0/bridge0"}) {
+		t.Errorf("expected only the bridge to be left, got %q", got)
+	}
+	log := ifs.Log()
+	want := []string{
+		"MoveFromJail eth1",
+		"RemoveFromBridge bridge0 epair1a",
+		"Destroy epair1a",
+		"MoveFromJail eth0",
+		"RemoveFromBridge bridge0 epair0a",
+		"Destroy epair0a",
+	}
+	if got := log[len(log)-len(want):]; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected rollback %q, got %q", want, got)
+	}
+
+	if _, err := v.Provision(3, []network.Epair{{Bridge: "bridge1"}}); !errors.Is(err, syscall.ENXIO) {
+		t.Errorf("expected ENXIO for missing bridge, got %v", err)
+	}
+}
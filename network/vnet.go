@@ -0,0 +1,243 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package network
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+// Interfaces performs the operations on network interfaces needed for
+// VNET jails.
+// Rename and SetUp operate on the interfaces of the jail jid, or of the
+// host if jid is 0.
+type Interfaces interface {
+	// CreateEpair creates an epair(4) and returns the names of its ends.
+	CreateEpair() (a, b string, err error)
+	// Destroy destroys the interface called name, for an epair both of
+	// its ends.
+	Destroy(name string) error
+	// AddToBridge adds the interface member to bridge.
+	AddToBridge(bridge, member string) error
+	// RemoveFromBridge removes the interface member from bridge.
+	RemoveFromBridge(bridge, member string) error
+	// MoveToJail moves the interface called name into the network stack
+	// of the jail jid.
+	MoveToJail(name string, jid int) error
+	// MoveFromJail moves the interface called name out of the network
+	// stack of the jail jid, back to the host.
+	MoveFromJail(name string, jid int) error
+	// Rename renames the interface called name to newName.
+	Rename(jid int, name, newName string) error
+	// SetUp brings the interface called name up.
+	SetUp(jid int, name string) error
+}
+
+// SystemInterfaces manages the interfaces of the running kernel.
+// The interfaces of the host are managed with ioctls, like ifconfig(8)
+// does, the interfaces in a jail by running /sbin/ifconfig inside the
+// jail, see gojail.Command.
+// On systems other than FreeBSD, all operations fail with ENOSYS.
+var SystemInterfaces Interfaces = sysInterfaces{}
+
+type sysInterfaces struct{}
+
+func ioctlError(op string, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, os.NewSyscallError("ioctl", err))
+	}
+	return nil
+}
+
+func (sysInterfaces) CreateEpair() (string, string, error) {
+	a, err := syscall.IfCreate("epair")
+	if err != nil {
+		return "", "", ioctlError("create epair", err)
+	}
+	return a, strings.TrimSuffix(a, "a") + "b", nil
+}
+
+func (sysInterfaces) Destroy(name string) error {
+	return ioctlError("destroy "+name, syscall.IfDestroy(name))
+}
+
+func (sysInterfaces) AddToBridge(bridge, member string) error {
+	return ioctlError(bridge+": add "+member, syscall.BridgeAdd(bridge, member))
+}
+
+func (sysInterfaces) RemoveFromBridge(bridge, member string) error {
+	return ioctlError(bridge+": delete "+member, syscall.BridgeDelete(bridge, member))
+}
+
+func (sysInterfaces) MoveToJail(name string, jid int) error {
+	return ioctlError(fmt.Sprintf("move %s to jail %d", name, jid), syscall.IfSetVnet(name, jid))
+}
+
+func (sysInterfaces) MoveFromJail(name string, jid int) error {
+	return ioctlError(fmt.Sprintf("move %s from jail %d", name, jid), syscall.IfReclaimVnet(name, jid))
+}
+
+func (sysInterfaces) Rename(jid int, name, newName string) error {
+	if jid != 0 {
+		return ifconfig(jid, name, "name", newName)
+	}
+	return ioctlError("rename "+name, syscall.IfRename(name, newName))
+}
+
+func (sysInterfaces) SetUp(jid int, name string) error {
+	if jid != 0 {
+		return ifconfig(jid, name, "up")
+	}
+	return ioctlError("set "+name+" up", syscall.IfSetUp(name))
+}
+
+// Runs ifconfig(8) in the jail jid, since the ioctls only reach the
+// network stack of the calling process.
+func ifconfig(jid int, args ...string) error {
+	cmd := gojail.Command(jid, "/sbin/ifconfig", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("jail %d: ifconfig %s: %s", jid, strings.Join(args, " "), msg)
+		}
+		return fmt.Errorf("jail %d: ifconfig %s: %w", jid, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// Epair is a network interface of a VNET jail: an epair(4), whose a end
+// stays on the host, optionally as a member of a bridge, and whose b end
+// is moved into the jail.
+type Epair struct {
+	// Bridge the host end is added to, none if empty.
+	Bridge string
+	// Name of the interface in the jail. If empty, the interface keeps
+	// the name of the b end.
+	Name string
+
+	// Names of the ends, set by Provision.
+	Host string
+	Jail string
+}
+
+// VNET sets up the network interfaces of VNET jails, created with the
+// vnet parameter set to new.
+type VNET struct {
+	// Interfaces defaults to SystemInterfaces.
+	Interfaces Interfaces
+}
+
+func (v *VNET) ifs() Interfaces {
+	if v.Interfaces == nil {
+		return SystemInterfaces
+	}
+	return v.Interfaces
+}
+
+// Provision creates the epairs of the jail jid. For each epair, it
+//
+//  1. creates the epair,
+//  2. adds the host end to the bridge,
+//  3. brings the host end up,
+//  4. moves the other end into the jail,
+//  5. renames it there and
+//  6. brings it up.
+//
+// It returns the epairs with the names of their ends, to pass to Release
+// when the jail is removed.
+// If a step fails, the steps done before are undone, so no interfaces are
+// left behind.
+func (v *VNET) Provision(jid int, epairs []Epair) ([]Epair, error) {
+	ifs := v.ifs()
+	var undo []func()
+	fail := func(err error) ([]Epair, error) {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return nil, err
+	}
+	var done []Epair
+	for _, e := range epairs {
+		a, b, err := ifs.CreateEpair()
+		if err != nil {
+			return fail(err)
+		}
+		undo = append(undo, func() { ifs.Destroy(a) })
+		e.Host, e.Jail = a, b
+		if e.Bridge != "" {
+			if err := ifs.AddToBridge(e.Bridge, a); err != nil {
+				return fail(err)
+			}
+			bridge := e.Bridge
+			undo = append(undo, func() { ifs.RemoveFromBridge(bridge, a) })
+		}
+		if err := ifs.SetUp(0, a); err != nil {
+			return fail(err)
+		}
+		if err := ifs.MoveToJail(b, jid); err != nil {
+			return fail(err)
+		}
+		// Keeps track of the name in the jail while undoing.
+		name := b
+		undo = append(undo, func() { ifs.MoveFromJail(name, jid) })
+		if e.Name != "" && e.Name != b {
+			if err := ifs.Rename(jid, b, e.Name); err != nil {
+				return fail(err)
+			}
+			name = e.Name
+			e.Jail = e.Name
+		}
+		if err := ifs.SetUp(jid, e.Jail); err != nil {
+			return fail(err)
+		}
+		done = append(done, e)
+	}
+	return done, nil
+}
+
+// Release destroys the epairs returned by Provision, in reverse order,
+// which also removes the ends in the jail.
+// It continues after failures and returns the first error.
+func (v *VNET) Release(epairs []Epair) error {
+	ifs := v.ifs()
+	var first error
+	for i := len(epairs) - 1; i >= 0; i-- {
+		e := epairs[i]
+		if e.Bridge != "" {
+			if err := ifs.RemoveFromBridge(e.Bridge, e.Host); err != nil && first == nil {
+				first = err
+			}
+		}
+		if err := ifs.Destroy(e.Host); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
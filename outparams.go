@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+	"purplekraken.com/pkg/gojail/internal/endian"
+)
+
+// Implemented by parameters which receive their value from GetParams.
+type outputParam interface {
+	JailParam
+	// Returns the buffer to pass to jail_get(2), nil for arrays.
+	buffer() []byte
+	// Returns the size of the elements of arrays, 0 for other
+	// parameters.
+	elemSize() int
+	// Stores the value returned by jail_get(2), a prefix of the buffer.
+	setData(b []byte)
+}
+
+// OutParam is a parameter which receives its value from GetParams.
+// The buffer for the value is sized according to the type of the
+// parameter, or for arrays like ip4.addr according to the length reported
+// by the kernel. After GetParams returns successfully, Data and Value
+// return the value reported by the kernel.
+type OutParam struct {
+	name []byte
+	info ParamInfo
+	buf  []byte
+	data []byte
+}
+
+// Want returns an output parameter for the parameter called name, which
+// must be known to the default registry.
+func Want(name string) (*OutParam, error) {
+	info, ok := LookupParam(name)
+	if !ok {
+		return nil, invalidParamError("unknown parameter: %s", name)
+	}
+	nameb, err := unix.ByteSliceFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	var size int
+	switch info.Type {
+	case String:
+		size = info.Size
+		if size == 0 {
+			size = maxpathlen
+		}
+	case Long, Ulong:
+		size = endian.LongSize
+	case IP4, IP6, Raw:
+		if !info.Array {
+			size = info.Size
+		}
+	default:
+		size = 4
+	}
+	return &OutParam{
+		name: nameb,
+		info: info,
+		buf:  make([]byte, size),
+	}, nil
+}
+
+func (p *OutParam) Name() []byte {
+	return p.name
+}
+
+// Data returns the value reported by the kernel, nil before the
+// parameter was passed to GetParams.
+func (p *OutParam) Data() []byte {
+	return p.data
+}
+
+func (p *OutParam) Type() ParamType {
+	return p.info.Type
+}
+
+func (p *OutParam) buffer() []byte {
+	return p.buf
+}
+
+func (p *OutParam) elemSize() int {
+	if !p.info.Array {
+		return 0
+	}
+	return p.info.Size
+}
+
+func (p *OutParam) setData(b []byte) {
+	p.data = b
+}
+
+// Value returns the decoded value of the parameter:
+// a string for String parameters, int for Int and JailSys, uint for Uint,
+// int64 for Long, uint64 for Ulong, bool for Bool and NoBool, []net.IP for
+// IP4 and IP6 and []byte for Raw parameters.
+// It returns nil if the parameter has no value.
+func (p *OutParam) Value() interface{} {
+	if p.data == nil {
+		return nil
+	}
+	switch p.info.Type {
+	case String:
+		return cstring(p.data)
+	case Int, JailSys:
+		if len(p.data) == 4 {
+			return bytesToInt(p.data)
+		}
+	case Uint:
+		if len(p.data) == 4 {
+			return uint(hostByteOrder.Uint32(p.data))
+		}
+	case Long:
+		if len(p.data) == endian.LongSize {
+			return bytesToLong(p.data)
+		}
+	case Ulong:
+		if len(p.data) == endian.LongSize {
+			return endian.Long(p.data)
+		}
+	case Bool, NoBool:
+		if len(p.data) == 4 {
+			return bytesToInt(p.data) != 0
+		}
+	case IP4, IP6:
+		return bytesToIPs(p.data, p.info.Size)
+	default:
+		return append([]byte(nil), p.data...)
+	}
+	return nil
+}
+
+// String returns the value as formatted by Export, or an empty string if
+// it cannot be exported.
+func (p *OutParam) String() string {
+	s, _ := Export(p)
+	return s
+}
+
+// Splits b into addresses of size bytes each.
+func bytesToIPs(b []byte, size int) []net.IP {
+	if size <= 0 {
+		return nil
+	}
+	ips := make([]net.IP, 0, len(b)/size)
+	for i := 0; i+size <= len(b); i += size {
+		ips = append(ips, append(net.IP(nil), b[i:i+size]...))
+	}
+	return ips
+}
+
+// StringOutParam is an output parameter for a string value.
+type StringOutParam struct {
+	OutParam
+}
+
+// StringOut returns an output parameter for the string parameter called
+// name.
+func StringOut(name string) (*StringOutParam, error) {
+	p, err := wantType(name, String)
+	if err != nil {
+		return nil, err
+	}
+	return &StringOutParam{*p}, nil
+}
+
+// Value returns the string without the terminating NUL.
+func (p *StringOutParam) Value() string {
+	return cstring(p.data)
+}
+
+// IntOutParam is an output parameter for an integer value.
+type IntOutParam struct {
+	OutParam
+}
+
+// IntOut returns an output parameter for the parameter called name, which
+// must be of type Int, Uint, Bool, NoBool or JailSys.
+func IntOut(name string) (*IntOutParam, error) {
+	p, err := wantType(name, Int, Uint, Bool, NoBool, JailSys)
+	if err != nil {
+		return nil, err
+	}
+	return &IntOutParam{*p}, nil
+}
+
+// Value returns the integer value, 0 if the parameter has no value.
+func (p *IntOutParam) Value() int {
+	if len(p.data) != 4 {
+		return 0
+	}
+	if p.info.Type == Uint {
+		return int(hostByteOrder.Uint32(p.data))
+	}
+	return bytesToInt(p.data)
+}
+
+// IPListOutParam is an output parameter for a list of addresses.
+type IPListOutParam struct {
+	OutParam
+}
+
+// IPListOut returns an output parameter for the parameter called name,
+// which must be a list of addresses like ip4.addr or ip6.addr.
+func IPListOut(name string) (*IPListOutParam, error) {
+	p, err := wantType(name, IP4, IP6)
+	if err != nil {
+		return nil, err
+	}
+	return &IPListOutParam{*p}, nil
+}
+
+// Value returns the addresses.
+func (p *IPListOutParam) Value() []net.IP {
+	return bytesToIPs(p.data, p.info.Size)
+}
+
+// Like Want, but the parameter must be of one of the given types.
+func wantType(name string, types ...ParamType) (*OutParam, error) {
+	p, err := Want(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range types {
+		if p.info.Type == t {
+			return p, nil
+		}
+	}
+	return nil, wrongTypeError(name, p.info.Type, types[0])
+}
@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"purplekraken.com/pkg/gojail/internal/endian"
+)
+
+var boolValues = [...]string{"false", "true"}
+
+var jailSysValues = [...]string{
+	jailSysDisable: "disable",
+	jailSysNew:     "new",
+	jailSysInherit: "inherit",
+}
+
+// Import returns the parameter called name with the value given as text,
+// like jailparam_import(3).
+// The text is parsed according to the type of the parameter in the default
+// registry, using the syntax of jail(8):
+// booleans are "true" or "false", or empty to set them, jailsys parameters
+// are "disable", "new" or "inherit", and arrays like ip4.addr are separated
+// by commas.
+// A boolean named with a "no" prefix is negated and returned under the name
+// of the underlying parameter, so Import("nopersist", "") is equivalent to
+// Import("persist", "false").
+func Import(name, text string) (JailParam, error) {
+	info, ok := LookupParam(name)
+	if !ok {
+		return nil, invalidParamError("unknown parameter: %s", name)
+	}
+	nameb, err := unix.ByteSliceFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	switch info.Type {
+	case String:
+		return NewStringParam(name, text)
+	case Bool, NoBool:
+		value := true
+		if text != "" {
+			i, ok := lookupValue(boolValues[:], text)
+			if !ok {
+				return nil, invalidParamError("%s: unknown boolean value \"%s\"", name, text)
+			}
+			value = i == 1
+		}
+		return newBoolParam(info, value)
+	case JailSys:
+		value := jailSysNew
+		if text != "" {
+			i, ok := lookupValue(jailSysValues[:], text)
+			if !ok {
+				if i, err = strconv.Atoi(text); err != nil || i < jailSysDisable || i > jailSysInherit {
+					return nil, invalidParamError("%s: unknown jailsys value \"%s\"", name, text)
+				}
+			}
+			value = i
+		}
+		return jailParam{name: nameb, data: intToBytes(value), ptype: JailSys}, nil
+	case Raw:
+		return nil, invalidParamError("%s: cannot import values of type %s", name, info.Type)
+	}
+
+	var elems []string
+	if info.Array {
+		if text != "" {
+			elems = strings.Split(text, ",")
+		}
+	} else {
+		elems = []string{text}
+	}
+	var data []byte
+	for _, elem := range elems {
+		elem = strings.TrimSpace(elem)
+		var b []byte
+		switch info.Type {
+		case Int:
+			var i int64
+			if i, err = strconv.ParseInt(elem, 10, 32); err == nil {
+				b = intToBytes(int(i))
+			}
+		case Uint:
+			var u uint64
+			if u, err = strconv.ParseUint(elem, 10, 32); err == nil {
+				b = intToBytes(int(u))
+			}
+		case Long:
+			var i int64
+			if i, err = strconv.ParseInt(elem, 10, endian.LongSize*8); err == nil {
+				b = longToBytes(uint64(i))
+			}
+		case Ulong:
+			var u uint64
+			if u, err = strconv.ParseUint(elem, 10, endian.LongSize*8); err == nil {
+				b = longToBytes(u)
+			}
+		case IP4:
+			ip := net.ParseIP(elem)
+			if ip == nil || ip.To4() == nil || strings.Contains(elem, ":") {
+				return nil, invalidParamError("%s: not an IPv4 address: \"%s\"", name, elem)
+			}
+			b = ip.To4()
+		case IP6:
+			ip := net.ParseIP(elem)
+			if ip == nil || !strings.Contains(elem, ":") {
+				return nil, invalidParamError("%s: not an IPv6 address: \"%s\"", name, elem)
+			}
+			b = ip.To16()
+		}
+		if err != nil {
+			return nil, invalidParamError("%s: invalid %s value \"%s\"", name, info.Type, elem)
+		}
+		data = append(data, b...)
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return jailParam{name: nameb, data: data, ptype: info.Type}, nil
+}
+
+// Returns the index of text in values, ignoring case.
+func lookupValue(values []string, text string) (int, bool) {
+	for i, v := range values {
+		if strings.EqualFold(v, text) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Export returns the value of p as text, like jailparam_export(3).
+// The format is the one accepted by Import, so for any parameter p
+// returned by Import, Import(name, Export(p)) yields the same value.
+func Export(p JailParam) (string, error) {
+	name := cstring(p.Name())
+	data := p.Data()
+	ptype := p.Type()
+	switch ptype {
+	case String:
+		return cstring(data), nil
+	case Raw:
+		return "", invalidParamError("%s: cannot export values of type %s", name, ptype)
+	case Bool, NoBool:
+		// Booleans passed to jail_set(2) by name only.
+		if len(data) == 0 {
+			return boolValues[1], nil
+		}
+	}
+
+	size := 4
+	switch ptype {
+	case Long, Ulong:
+		size = endian.LongSize
+	case IP4:
+		size = net.IPv4len
+	case IP6:
+		size = net.IPv6len
+	}
+	if len(data)%size != 0 {
+		return "", invalidParamError("%s: invalid length %d for a value of type %s", name, len(data), ptype)
+	}
+	elems := make([]string, 0, len(data)/size)
+	for i := 0; i < len(data); i += size {
+		b := data[i : i+size]
+		var s string
+		switch ptype {
+		case Int:
+			s = strconv.Itoa(bytesToInt(b))
+		case Uint:
+			s = strconv.FormatUint(uint64(hostByteOrder.Uint32(b)), 10)
+		case Long:
+			s = strconv.FormatInt(bytesToLong(b), 10)
+		case Ulong:
+			s = strconv.FormatUint(endian.Long(b), 10)
+		case Bool, NoBool:
+			s = boolValues[0]
+			if bytesToInt(b) != 0 {
+				s = boolValues[1]
+			}
+		case JailSys:
+			i := bytesToInt(b)
+			if i >= 0 && i < len(jailSysValues) {
+				s = jailSysValues[i]
+			} else {
+				s = strconv.Itoa(i)
+			}
+		case IP4:
+			s = net.IP(b).String()
+		case IP6:
+			s = net.IP(b).String()
+			if !strings.Contains(s, ":") {
+				// IPv4-mapped addresses, which Import takes as IPv4
+				// addresses without the prefix.
+				s = "::ffff:" + s
+			}
+		default:
+			return "", invalidParamError("%s: cannot export values of type %s", name, ptype)
+		}
+		elems = append(elems, s)
+	}
+	return strings.Join(elems, ","), nil
+}
@@ -0,0 +1,313 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package passwd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Names of the special login classes, see login.conf(5).
+const (
+	DefaultClass = "default"
+	RootClass    = "root"
+)
+
+// Search path used if the login class has no path capability.
+var defaultPath = []string{"/sbin", "/bin", "/usr/sbin", "/usr/bin", "/usr/local/sbin", "/usr/local/bin", "~/bin"}
+
+// Maximum depth of tc= references.
+const maxClassDepth = 32
+
+// LoginClass holds the capabilities of a login class from login.conf(5).
+type LoginClass struct {
+	Name string
+	caps map[string]string
+}
+
+// A record of the capability database, with the capabilities in order.
+type capRecord struct {
+	names []string
+	caps  []string
+}
+
+// Splits s at unescaped colons.
+func splitCaps(s string) []string {
+	var fields []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ':':
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:])
+}
+
+// Reads the records of a capability database like login.conf.
+func readCapDB(path string) ([]capRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []capRecord
+	var entry strings.Builder
+	flush := func() {
+		s := strings.TrimSpace(entry.String())
+		entry.Reset()
+		if s == "" {
+			return
+		}
+		fields := splitCaps(s)
+		r := capRecord{names: strings.Split(fields[0], "|")}
+		for _, f := range fields[1:] {
+			if f = strings.TrimSpace(f); f != "" {
+				r.caps = append(r.caps, f)
+			}
+		}
+		records = append(records, r)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			entry.WriteString(strings.TrimSuffix(line, "\\"))
+			continue
+		}
+		entry.WriteString(line)
+		flush()
+	}
+	flush()
+	return records, nil
+}
+
+func findRecord(records []capRecord, name string) (capRecord, bool) {
+	for _, r := range records {
+		for _, n := range r.names {
+			if n == name {
+				return r, true
+			}
+		}
+	}
+	return capRecord{}, false
+}
+
+// Adds the capabilities of the record called name to caps, unless they are
+// set already, following tc= references.
+func resolveCaps(records []capRecord, name string, caps map[string]string, depth int) error {
+	if depth > maxClassDepth {
+		return fmt.Errorf("login class %s: tc= references nested too deeply", name)
+	}
+	r, ok := findRecord(records, name)
+	if !ok {
+		return fmt.Errorf("login class %s: %w", name, ErrNotFound)
+	}
+	var inherit []string
+	for _, c := range r.caps {
+		key, value := c, ""
+		if i := strings.IndexAny(c, "=#@"); i >= 0 {
+			key = c[:i]
+			if c[i] == '@' {
+				// Cancelled capability, hides inherited values.
+				if _, ok := caps[key]; !ok {
+					caps[key] = "\x00"
+				}
+				continue
+			}
+			value = unescapeCap(c[i+1:])
+		}
+		if key == "tc" {
+			inherit = append(inherit, value)
+			continue
+		}
+		if _, ok := caps[key]; !ok {
+			caps[key] = value
+		}
+	}
+	for _, tc := range inherit {
+		if err := resolveCaps(records, tc, caps, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolves the escape sequences of a capability value.
+func unescapeCap(s string) string {
+	if !strings.ContainsAny(s, "\\^") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch c = s[i]; c {
+			case 'e', 'E':
+				b.WriteByte(0x1b)
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := 1
+				for n < 3 && i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '7' {
+					n++
+				}
+				v, _ := strconv.ParseUint(s[i:i+n], 8, 16)
+				b.WriteByte(byte(v))
+				i += n - 1
+			default:
+				b.WriteByte(c)
+			}
+		case c == '^' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i] & 0x1f)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// LookupClass returns the login class called name from etc/login.conf
+// below root. The default class is used if name is empty or does not
+// exist, and an empty class if there is no login.conf.
+func LookupClass(root, name string) (*LoginClass, error) {
+	if name == "" {
+		name = DefaultClass
+	}
+	records, err := readCapDB(filepath.Join(root, "etc", "login.conf"))
+	if os.IsNotExist(err) {
+		return &LoginClass{Name: DefaultClass, caps: map[string]string{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := findRecord(records, name); !ok {
+		name = DefaultClass
+		if _, ok := findRecord(records, name); !ok {
+			return &LoginClass{Name: DefaultClass, caps: map[string]string{}}, nil
+		}
+	}
+	caps := map[string]string{}
+	if err := resolveCaps(records, name, caps, 0); err != nil {
+		return nil, err
+	}
+	return &LoginClass{Name: name, caps: caps}, nil
+}
+
+// ClassOf returns the name of the login class of u: its class, the root
+// class for the superuser without a class, or the default class.
+func ClassOf(u *User) string {
+	switch {
+	case u.Class != "":
+		return u.Class
+	case u.UID == 0:
+		return RootClass
+	}
+	return DefaultClass
+}
+
+// Capability returns the value of the capability name, which is empty for
+// boolean capabilities.
+func (c *LoginClass) Capability(name string) (string, bool) {
+	v, ok := c.caps[name]
+	if !ok || v == "\x00" {
+		return "", false
+	}
+	return v, true
+}
+
+// Umask returns the umask of the class.
+func (c *LoginClass) Umask() (int, bool) {
+	s, ok := c.Capability("umask")
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// Replaces "~" at the start of s by the home directory of u.
+func expandHome(s string, u *User) string {
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		return u.Home + s[1:]
+	}
+	return s
+}
+
+// Path returns the directories of the search path of the class for u.
+func (c *LoginClass) Path(u *User) []string {
+	path := defaultPath
+	if s, ok := c.Capability("path"); ok {
+		path = strings.Fields(s)
+	}
+	dirs := make([]string, len(path))
+	for i, dir := range path {
+		dirs[i] = expandHome(dir, u)
+	}
+	return dirs
+}
+
+// Env returns the environment variables the class sets for u, from the
+// setenv, lang and charset capabilities.
+// In setenv, "$" is replaced by the name of the user and "~" by its home
+// directory.
+func (c *LoginClass) Env(u *User) []string {
+	var env []string
+	if s, ok := c.Capability("setenv"); ok {
+		for _, kv := range strings.Split(s, ",") {
+			if !strings.Contains(kv, "=") {
+				continue
+			}
+			kv = strings.ReplaceAll(kv, "$", u.Name)
+			kv = strings.ReplaceAll(kv, "~", u.Home)
+			env = append(env, kv)
+		}
+	}
+	if s, ok := c.Capability("lang"); ok {
+		env = append(env, "LANG="+s)
+	}
+	if s, ok := c.Capability("charset"); ok {
+		env = append(env, "MM_CHARSET="+s)
+	}
+	return env
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package passwd reads the user, group and login class databases of a
+// FreeBSD system, like the root file system of a jail, without using the C
+// library.
+//
+// Users are read from etc/master.passwd if it is readable, which includes
+// the login classes, and from etc/passwd otherwise.
+package passwd // import "purplekraken.com/pkg/gojail/passwd"
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned if a user, group or login class does not exist.
+var ErrNotFound = errors.New("not found")
+
+// User is an entry of the passwd database.
+type User struct {
+	Name  string
+	UID   int
+	GID   int
+	Class string // Login class, empty if unknown or the default
+	Gecos string
+	Home  string
+	Shell string
+}
+
+// Group is an entry of the group database.
+type Group struct {
+	Name    string
+	GID     int
+	Members []string
+}
+
+// Reads the lines of the database file, skipping comments and empty lines,
+// and calls fn with the colon-separated fields of each line until it
+// returns true. Like getpwent(3) and getgrent(3), fn skips lines it cannot
+// parse, so that a malformed entry does not hide the entries after it.
+func scanFile(path string, fn func(fields []string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fn(strings.Split(line, ":")) {
+			return nil
+		}
+	}
+	return s.Err()
+}
+
+func parseID(s, what string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid %s %q", what, s)
+	}
+	return id, nil
+}
+
+// Parses an entry of master.passwd, with 10 fields, or passwd, with 7.
+func parseUser(fields []string) (*User, error) {
+	var u User
+	var err error
+	switch len(fields) {
+	case 10:
+		u.Class = fields[4]
+		u.Gecos, u.Home, u.Shell = fields[7], fields[8], fields[9]
+	case 7:
+		u.Gecos, u.Home, u.Shell = fields[4], fields[5], fields[6]
+	default:
+		return nil, fmt.Errorf("invalid number of fields: %d", len(fields))
+	}
+	u.Name = fields[0]
+	if u.UID, err = parseID(fields[2], "user ID"); err != nil {
+		return nil, err
+	}
+	if u.GID, err = parseID(fields[3], "group ID"); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Returns the path of the user database below root.
+func userFile(root string) string {
+	master := filepath.Join(root, "etc", "master.passwd")
+	if f, err := os.Open(master); err == nil {
+		f.Close()
+		return master
+	}
+	return filepath.Join(root, "etc", "passwd")
+}
+
+func lookupUser(root string, match func(u *User) bool) (*User, error) {
+	var found *User
+	err := scanFile(userFile(root), func(fields []string) bool {
+		if strings.HasPrefix(fields[0], "+") || strings.HasPrefix(fields[0], "-") {
+			// NIS compat entries
+			return false
+		}
+		u, err := parseUser(fields)
+		if err != nil || !match(u) {
+			return false
+		}
+		found = u
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// LookupUser returns the user called name from the database below root.
+// A numeric name is looked up as user ID if there is no user of that name.
+func LookupUser(root, name string) (*User, error) {
+	u, err := lookupUser(root, func(u *User) bool { return u.Name == name })
+	if errors.Is(err, ErrNotFound) {
+		if uid, perr := strconv.Atoi(name); perr == nil {
+			return LookupUserID(root, uid)
+		}
+		return nil, fmt.Errorf("user %s: %w", name, err)
+	}
+	return u, err
+}
+
+// LookupUserID returns the user with the ID uid from the database below
+// root.
+func LookupUserID(root string, uid int) (*User, error) {
+	u, err := lookupUser(root, func(u *User) bool { return u.UID == uid })
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("user ID %d: %w", uid, err)
+	}
+	return u, err
+}
+
+// Groups returns the groups of the database below root in order.
+func Groups(root string) ([]*Group, error) {
+	var groups []*Group
+	err := scanFile(filepath.Join(root, "etc", "group"), func(fields []string) bool {
+		if strings.HasPrefix(fields[0], "+") || strings.HasPrefix(fields[0], "-") || len(fields) != 4 {
+			return false
+		}
+		gid, err := parseID(fields[2], "group ID")
+		if err != nil {
+			return false
+		}
+		g := &Group{Name: fields[0], GID: gid}
+		if fields[3] != "" {
+			g.Members = strings.Split(fields[3], ",")
+		}
+		groups = append(groups, g)
+		return false
+	})
+	return groups, err
+}
+
+// LookupGroup returns the group called name from the database below root.
+func LookupGroup(root, name string) (*Group, error) {
+	groups, err := Groups(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Name == name {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("group %s: %w", name, ErrNotFound)
+}
+
+// GroupIDs returns the IDs of the groups of u, like getgrouplist(3): its
+// primary group, followed by the groups listing u as a member.
+func GroupIDs(root string, u *User) ([]int, error) {
+	groups, err := Groups(root)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	gids := []int{u.GID}
+	for _, g := range groups {
+		for _, m := range g.Members {
+			if m == u.Name && g.GID != u.GID {
+				gids = append(gids, g.GID)
+				break
+			}
+		}
+	}
+	return gids, nil
+}
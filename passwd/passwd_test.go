@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package passwd_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"purplekraken.com/pkg/gojail/passwd"
+)
+
+const root = "testdata/rootfs"
+
+func TestLookupUser(t *testing.T) {
+	alice, err := passwd.LookupUser(root, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &passwd.User{Name: "alice", UID: 1001, GID: 1001, Class: "staff", Gecos: "Alice", Home: "/home/alice", Shell: "/bin/csh"}
+	if !reflect.DeepEqual(alice, want) {
+		t.Errorf("expected %+v, got %+v", want, alice)
+	}
+	if u, err := passwd.LookupUser(root, "80"); err != nil || u.Name != "www" {
+		t.Errorf("expected www for numeric name, got %v (%v)", u, err)
+	}
+	if u, err := passwd.LookupUserID(root, 0); err != nil || u.Name != "root" {
+		t.Errorf("expected root for ID 0, got %v (%v)", u, err)
+	}
+	if _, err := passwd.LookupUser(root, "mallory"); !errors.Is(err, passwd.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// Without master.passwd, users have no login class.
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "etc", "passwd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "etc", "passwd"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := passwd.LookupUser(dir, "alice"); err != nil || u.Class != "" || u.Home != "/home/alice" {
+		t.Errorf("unexpected user from passwd: %+v (%v)", u, err)
+	}
+
+	// Malformed entries are skipped, without hiding the entries after them.
+	data = append([]byte("bad:*:x:0:::\nshort:*:1:1\n"), data...)
+	if err := os.WriteFile(filepath.Join(dir, "etc", "passwd"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := passwd.LookupUser(dir, "bad"); !errors.Is(err, passwd.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a malformed entry, got %v", err)
+	}
+	if u, err := passwd.LookupUser(dir, "alice"); err != nil || u.UID != 1001 {
+		t.Errorf("expected alice after malformed entries, got %v (%v)", u, err)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	alice, err := passwd.LookupUser(root, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gids, err := passwd.GroupIDs(root, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1001, 0, 20}; !reflect.DeepEqual(gids, want) {
+		t.Errorf("expected groups %v, got %v", want, gids)
+	}
+	g, err := passwd.LookupGroup(root, "staff")
+	if err != nil || g.GID != 20 || !reflect.DeepEqual(g.Members, []string{"alice", "bob"}) {
+		t.Errorf("unexpected group %+v (%v)", g, err)
+	}
+	if g, err := passwd.LookupGroup(root, "daemon"); err != nil || g.Members != nil {
+		t.Errorf("expected group without members, got %+v (%v)", g, err)
+	}
+}
+
+func TestLoginClass(t *testing.T) {
+	alice, err := passwd.LookupUser(root, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staff, err := passwd.LookupClass(root, passwd.ClassOf(alice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if umask, ok := staff.Umask(); !ok || umask != 002 {
+		t.Errorf("expected umask 002, got %o", umask)
+	}
+	if got, want := staff.Path(alice), []string{"/usr/local/bin", "/usr/bin", "/bin", "/home/alice/bin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected path %v, got %v", want, got)
+	}
+	want := []string{"BLOCKSIZE=K", "MAIL=/var/mail/alice", "HISTFILE=/home/alice/.history", "LANG=C.UTF-8"}
+	if got := staff.Env(alice); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected environment %v, got %v", want, got)
+	}
+
+	rootUser, err := passwd.LookupUser(root, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	class, err := passwd.LookupClass(root, passwd.ClassOf(rootUser))
+	if err != nil || class.Name != passwd.RootClass {
+		t.Fatalf("expected the root class, got %v (%v)", class, err)
+	}
+	if _, ok := class.Capability("ignorenologin"); !ok {
+		t.Errorf("expected boolean capability")
+	}
+	if umask, ok := class.Umask(); !ok || umask != 022 {
+		t.Errorf("expected inherited umask 022, got %o", umask)
+	}
+	if class, err := passwd.LookupClass(root, "missing"); err != nil || class.Name != passwd.DefaultClass {
+		t.Errorf("expected fallback to the default class, got %v (%v)", class, err)
+	}
+	if class, err := passwd.LookupClass(t.TempDir(), ""); err != nil || len(class.Path(rootUser)) == 0 {
+		t.Errorf("expected defaults without login.conf, got %v (%v)", class, err)
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"errors"
+	sys "syscall"
+
+	"golang.org/x/sys/unix"
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+// Process is a process running in a jail.
+type Process struct {
+	PID     int
+	JID     int
+	Command string // Name of the executable, truncated to 19 bytes
+}
+
+// ProcessTable finds and signals the processes of jails, used by Stop.
+type ProcessTable interface {
+	// Processes returns the processes of the jail jid.
+	Processes(jid int) ([]Process, error)
+	// Signal sends sig to the process pid. If the process no longer
+	// exists, the error is ESRCH.
+	Signal(pid int, sig sys.Signal) error
+}
+
+// SystemProcesses is the process table of the running kernel, read from
+// the kern.proc.proc sysctl.
+// On systems other than FreeBSD, listing processes fails with
+// ErrNotSupported.
+var SystemProcesses ProcessTable = sysProcessTable{}
+
+type sysProcessTable struct{}
+
+func (sysProcessTable) Processes(jid int) ([]Process, error) {
+	mib, err := syscall.SysctlNameToMIB("kern.proc.proc")
+	if err != nil {
+		return nil, syscallError("sysctl", err)
+	}
+	var b []byte
+	// The table can grow between measuring and reading it.
+	for i := 0; ; i++ {
+		b, err = syscall.SysctlValue(mib)
+		if !errors.Is(err, sys.ENOMEM) || i == 10 {
+			break
+		}
+	}
+	if err != nil {
+		return nil, syscallError("sysctl", err)
+	}
+	return parseKinfoProcs(b, jid)
+}
+
+func (sysProcessTable) Signal(pid int, sig sys.Signal) error {
+	return unix.Kill(pid, sig)
+}
+
+// Offsets of the fields of struct kinfo_proc in sys/user.h, which differ
+// between platforms because of the sizes of pointers, longs and time_t.
+type kinfoLayout struct {
+	pid, comm, jid int
+}
+
+// Layouts by the size of the structure: 64-bit platforms, i386 and other
+// 32-bit platforms.
+var kinfoLayouts = map[int]kinfoLayout{
+	1088: {pid: 72, comm: 447, jid: 592},
+	768:  {pid: 40, comm: 367, jid: 512},
+	816:  {pid: 40, comm: 383, jid: 528},
+}
+
+const kinfoCommLen = 20 // COMMLEN+1 in sys/user.h
+
+// Returns the processes of the jail jid from an array of struct
+// kinfo_proc.
+func parseKinfoProcs(b []byte, jid int) ([]Process, error) {
+	var procs []Process
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, invalidKinfoError()
+		}
+		size := bytesToInt(b)
+		layout, ok := kinfoLayouts[size]
+		if !ok || len(b) < size {
+			return nil, invalidKinfoError()
+		}
+		if bytesToInt(b[layout.jid:]) == jid {
+			procs = append(procs, Process{
+				PID:     bytesToInt(b[layout.pid:]),
+				JID:     jid,
+				Command: cstring(b[layout.comm : layout.comm+kinfoCommLen]),
+			})
+		}
+		b = b[size:]
+	}
+	return procs, nil
+}
+
+func invalidKinfoError() error {
+	return newJailErr("sysctl", sys.ENOTSUP, "unknown layout of struct kinfo_proc")
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// Returns a struct kinfo_proc of the given size.
+func kinfoProc(size, pid, jid int, comm string) []byte {
+	layout := kinfoLayouts[size]
+	b := make([]byte, size)
+	copy(b, intToBytes(size))
+	copy(b[layout.pid:], intToBytes(pid))
+	copy(b[layout.jid:], intToBytes(jid))
+	copy(b[layout.comm:layout.comm+kinfoCommLen-1], comm)
+	return b
+}
+
+func TestParseKinfoProcs(t *testing.T) {
+	for size := range kinfoLayouts {
+		var b []byte
+		b = append(b, kinfoProc(size, 1, 0, "init")...)
+		b = append(b, kinfoProc(size, 42, 3, "sh")...)
+		b = append(b, kinfoProc(size, 43, 3, "a-very-long-command-name")...)
+		procs, err := parseKinfoProcs(b, 3)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		want := []Process{{PID: 42, JID: 3, Command: "sh"}, {PID: 43, JID: 3, Command: "a-very-long-command"}}
+		if !reflect.DeepEqual(procs, want) {
+			t.Errorf("size %d: got %+v, expected %+v", size, procs, want)
+		}
+		if _, err := parseKinfoProcs(b[:len(b)-1], 3); !errors.Is(err, syscall.ENOTSUP) {
+			t.Errorf("size %d: expected ENOTSUP for truncated buffer, got %v", size, err)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+// Package pty runs commands in jails on pseudo-terminals, for interactive
+// sessions.
+package pty // import "purplekraken.com/pkg/gojail/pty"
+
+import (
+	"os"
+	"os/signal"
+	sys "syscall"
+
+	"golang.org/x/sys/unix"
+	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+// Open allocates a pseudo-terminal and returns its controller and
+// terminal side.
+// On systems other than FreeBSD, it fails with ENOSYS.
+func Open() (controller, terminal *os.File, err error) {
+	fd, err := syscall.PosixOpenpt(unix.O_RDWR | unix.O_NOCTTY | unix.O_CLOEXEC)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("posix_openpt", err)
+	}
+	name, err := syscall.Ptsname(fd)
+	if err != nil {
+		unix.Close(fd)
+		return nil, nil, os.NewSyscallError("ptsname", err)
+	}
+	// Non-blocking, so Close interrupts pending reads.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, nil, os.NewSyscallError("fcntl", err)
+	}
+	controller = os.NewFile(uintptr(fd), "/dev/ptmx")
+	terminal, err = os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		controller.Close()
+		return nil, nil, err
+	}
+	return controller, terminal, nil
+}
+
+// PTY is the controller side of a pseudo-terminal a command runs on.
+// Reading returns the output of the command, writing sends input to it.
+type PTY struct {
+	f *os.File
+	// The command running on the terminal.
+	Cmd *gojail.Cmd
+}
+
+// Start starts cmd on a new pseudo-terminal, as the leader of a new
+// session with the terminal as controlling terminal.
+// Stdin, Stdout and Stderr of cmd are connected to the terminal unless
+// they are set already.
+func Start(cmd *gojail.Cmd) (*PTY, error) {
+	controller, terminal, err := Open()
+	if err != nil {
+		return nil, err
+	}
+	defer terminal.Close()
+	if cmd.Stdin == nil {
+		cmd.Stdin = terminal
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = terminal
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = terminal
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &sys.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0 // Standard input of the child
+	if err := cmd.Start(); err != nil {
+		controller.Close()
+		return nil, err
+	}
+	return &PTY{f: controller, Cmd: cmd}, nil
+}
+
+func (p *PTY) Read(b []byte) (int, error) {
+	return p.f.Read(b)
+}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	return p.f.Write(b)
+}
+
+// Close closes the controller side of the terminal, which hangs up the
+// terminal of the command.
+func (p *PTY) Close() error {
+	return p.f.Close()
+}
+
+// Resize sets the window size of the terminal, which sends SIGWINCH to
+// the command.
+func (p *PTY) Resize(rows, cols uint16) error {
+	return SetSize(p.f, rows, cols)
+}
+
+// Size returns the window size of the terminal.
+func (p *PTY) Size() (rows, cols uint16, err error) {
+	return GetSize(p.f)
+}
+
+// ForwardResize sets the window size of the terminal to the size of term,
+// and again whenever the process receives SIGWINCH, until stop is called.
+func (p *PTY) ForwardResize(term *os.File) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sys.SIGWINCH)
+	// Set the initial size, unless a SIGWINCH is already pending.
+	select {
+	case ch <- sys.SIGWINCH:
+	default:
+	}
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if rows, cols, err := GetSize(term); err == nil {
+					p.Resize(rows, cols)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// Calls fn with the file descriptor of f. Unlike f.Fd, this keeps f in
+// non-blocking mode, so Close still interrupts pending reads.
+func control(f *os.File, fn func(fd int) error) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) { ferr = fn(int(fd)) }); err != nil {
+		return err
+	}
+	return ferr
+}
+
+// GetSize returns the window size of the terminal f.
+func GetSize(f *os.File) (rows, cols uint16, err error) {
+	var ws *unix.Winsize
+	err = control(f, func(fd int) error {
+		var err error
+		ws, err = unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+		return os.NewSyscallError("ioctl", err)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return ws.Row, ws.Col, nil
+}
+
+// SetSize sets the window size of the terminal f.
+func SetSize(f *os.File, rows, cols uint16) error {
+	ws := &unix.Winsize{Row: rows, Col: cols}
+	return control(f, func(fd int) error {
+		return os.NewSyscallError("ioctl", unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, ws))
+	})
+}
+
+// MakeRaw puts the terminal f into raw mode, like cfmakeraw(3), and
+// returns a function restoring the previous mode.
+func MakeRaw(f *os.File) (restore func() error, err error) {
+	var old *unix.Termios
+	err = control(f, func(fd int) error {
+		var err error
+		old, err = unix.IoctlGetTermios(fd, ioctlGetTermios)
+		return os.NewSyscallError("ioctl", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	err = control(f, func(fd int) error {
+		return os.NewSyscallError("ioctl", unix.IoctlSetTermios(fd, ioctlSetTermios, &raw))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		return control(f, func(fd int) error {
+			return os.NewSyscallError("ioctl", unix.IoctlSetTermios(fd, ioctlSetTermios, old))
+		})
+	}, nil
+}
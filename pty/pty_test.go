@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package pty_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"purplekraken.com/pkg/gojail"
+	"purplekraken.com/pkg/gojail/pty"
+)
+
+func TestOpen(t *testing.T) {
+	controller, terminal, err := pty.Open()
+	if runtime.GOOS != "freebsd" {
+		if !errors.Is(err, syscall.ENOSYS) {
+			t.Errorf("expected ENOSYS, got %v", err)
+		}
+		if _, err := pty.Start(gojail.Command(1, "/bin/sh")); !errors.Is(err, syscall.ENOSYS) {
+			t.Errorf("expected ENOSYS from Start, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer controller.Close()
+	defer terminal.Close()
+
+	if err := pty.SetSize(controller, 24, 80); err != nil {
+		t.Fatal(err)
+	}
+	if rows, cols, err := pty.GetSize(terminal); err != nil || rows != 24 || cols != 80 {
+		t.Errorf("expected 24x80, got %dx%d (%v)", rows, cols, err)
+	}
+	restore, err := pty.MakeRaw(terminal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without raw mode, the carriage return would be read as a newline.
+	if _, err := controller.Write([]byte("x\r")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(terminal, buf); err != nil || string(buf) != "x\r" {
+		t.Errorf("expected raw input %q, got %q (%v)", "x\r", buf, err)
+	}
+	if err := restore(); err != nil {
+		t.Errorf("restore: %v", err)
+	}
+}
+
+func TestMakeRawNoTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := pty.MakeRaw(f); err == nil {
+		t.Errorf("expected error for a regular file")
+	}
+	if _, _, err := pty.GetSize(f); err == nil {
+		t.Errorf("expected error for a regular file")
+	}
+}
+
+func TestCloseAfterIoctl(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// Fails for a pipe, but must leave it in non-blocking mode.
+	pty.GetSize(r)
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrClosed) {
+			t.Errorf("expected os.ErrClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not interrupt the read")
+	}
+}
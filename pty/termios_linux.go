@@ -24,8 +24,14 @@
 // OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
 // SUCH DAMAGE.
 
-package gojail
+//go:build linux
+// +build linux
 
-import "encoding/binary"
+package pty
 
-var hostByteOrder = binary.LittleEndian
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlGetTermios = unix.TCGETS
+	ioctlSetTermios = unix.TCSETS
+)
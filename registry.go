@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+// ParamInfo describes a jail parameter and how the kernel expects its value.
+type ParamInfo struct {
+	// Name of the parameter, for NoBool parameters the name of the
+	// underlying boolean without the "no" prefix.
+	Name string
+	Type ParamType
+	// Maximum length of String values including the terminating NUL,
+	// size of a single element for Raw, IP4 and IP6 values.
+	// Zero if the size is fixed by the type.
+	Size int
+	// Set if the parameter holds a list of values, like ip4.addr.
+	Array bool
+	// Set if the parameter can only be read.
+	ReadOnly bool
+	// Set if the parameter can only be set when the jail is created.
+	CreateOnly bool
+}
+
+// Registry maps parameter names to their types, like the
+// security.jail.param sysctl tree, which jailparam(3) uses for the same
+// purpose.
+type Registry struct {
+	params map[string]ParamInfo
+}
+
+// NewRegistry returns a registry containing params.
+func NewRegistry(params []ParamInfo) *Registry {
+	r := &Registry{
+		params: make(map[string]ParamInfo, len(params)),
+	}
+	for _, p := range params {
+		r.params[p.Name] = p
+	}
+	return r
+}
+
+// Lookup returns the description of the parameter called name.
+// Names of boolean parameters with a "no" prefix on their last component,
+// like "nopersist" or "allow.noraw_sockets", are reported as NoBool.
+func (r *Registry) Lookup(name string) (ParamInfo, bool) {
+	if p, ok := r.params[name]; ok {
+		return p, true
+	}
+	if base, ok := stripNo(name); ok {
+		if p, ok := r.params[base]; ok && p.Type == Bool {
+			p.Type = NoBool
+			return p, true
+		}
+	}
+	return ParamInfo{}, false
+}
+
+// Params returns all parameters in the registry, sorted by name.
+func (r *Registry) Params() []ParamInfo {
+	params := make([]ParamInfo, 0, len(r.params))
+	for _, p := range r.params {
+		params = append(params, p)
+	}
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Name < params[j].Name
+	})
+	return params
+}
+
+// Removes the "no" prefix from the last component of name.
+func stripNo(name string) (string, bool) {
+	i := strings.LastIndexByte(name, '.') + 1
+	if !strings.HasPrefix(name[i:], "no") || len(name[i:]) == 2 {
+		return "", false
+	}
+	return name[:i] + name[i+2:], true
+}
+
+// Adds the "no" prefix to the last component of name.
+func addNo(name string) string {
+	i := strings.LastIndexByte(name, '.') + 1
+	return name[:i] + "no" + name[i:]
+}
+
+// Parameters of FreeBSD 13, used if the sysctl tree is not available.
+var staticParams = []ParamInfo{
+	{Name: "jid", Type: Int, CreateOnly: true},
+	{Name: "parent", Type: Int, ReadOnly: true},
+	{Name: "name", Type: String, Size: maxnamelen},
+	{Name: "path", Type: String, Size: maxpathlen, CreateOnly: true},
+	{Name: "securelevel", Type: Int},
+	{Name: "enforce_statfs", Type: Int},
+	{Name: "devfs_ruleset", Type: Int},
+	{Name: "persist", Type: Bool},
+	{Name: "dying", Type: Bool, ReadOnly: true},
+	{Name: "osreldate", Type: Int, CreateOnly: true},
+	{Name: "osrelease", Type: String, Size: 32, CreateOnly: true},
+	{Name: "children.max", Type: Int},
+	{Name: "children.cur", Type: Int, ReadOnly: true},
+	{Name: "cpuset.id", Type: Int, ReadOnly: true},
+	{Name: "host", Type: JailSys},
+	{Name: "host.hostname", Type: String, Size: maxnamelen},
+	{Name: "host.domainname", Type: String, Size: maxnamelen},
+	{Name: "host.hostuuid", Type: String, Size: 64},
+	{Name: "host.hostid", Type: Ulong},
+	{Name: "ip4", Type: JailSys},
+	{Name: "ip4.addr", Type: IP4, Size: 4, Array: true},
+	{Name: "ip4.saddrsel", Type: Bool},
+	{Name: "ip6", Type: JailSys},
+	{Name: "ip6.addr", Type: IP6, Size: 16, Array: true},
+	{Name: "ip6.saddrsel", Type: Bool},
+	{Name: "vnet", Type: JailSys, CreateOnly: true},
+	{Name: "sysvmsg", Type: JailSys},
+	{Name: "sysvsem", Type: JailSys},
+	{Name: "sysvshm", Type: JailSys},
+	{Name: "allow.set_hostname", Type: Bool},
+	{Name: "allow.sysvipc", Type: Bool},
+	{Name: "allow.raw_sockets", Type: Bool},
+	{Name: "allow.chflags", Type: Bool},
+	{Name: "allow.mount", Type: Bool},
+	{Name: "allow.mount.devfs", Type: Bool},
+	{Name: "allow.mount.fdescfs", Type: Bool},
+	{Name: "allow.mount.nullfs", Type: Bool},
+	{Name: "allow.mount.procfs", Type: Bool},
+	{Name: "allow.mount.tmpfs", Type: Bool},
+	{Name: "allow.mount.zfs", Type: Bool},
+	{Name: "allow.quotas", Type: Bool},
+	{Name: "allow.socket_af", Type: Bool},
+	{Name: "allow.mlock", Type: Bool},
+	{Name: "allow.reserved_ports", Type: Bool},
+	{Name: "allow.read_msgbuf", Type: Bool},
+	{Name: "allow.unprivileged_proc_debug", Type: Bool},
+	{Name: "allow.suser", Type: Bool},
+	{Name: "allow.nfsd", Type: Bool},
+}
+
+// StaticRegistry returns a registry with the parameters of a stock
+// FreeBSD 13 kernel.
+func StaticRegistry() *Registry {
+	return NewRegistry(staticParams)
+}
+
+const sysctlParamPrefix = "security.jail.param."
+
+// LoadRegistry builds a registry from the security.jail.param sysctl tree
+// of the running kernel, which includes the parameters of loaded modules.
+func LoadRegistry() (*Registry, error) {
+	root, err := syscall.SysctlNameToMIB(strings.TrimSuffix(sysctlParamPrefix, "."))
+	if err != nil {
+		return nil, syscallError("sysctl", err)
+	}
+	var params []ParamInfo
+	for mib := root; ; {
+		mib, err = syscall.SysctlNext(mib)
+		if err != nil || !mibHasPrefix(mib, root) {
+			break
+		}
+		kind, format, err := syscall.SysctlFormat(mib)
+		if err != nil {
+			return nil, syscallError("sysctl", err)
+		}
+		if kind&syscall.CTLTYPE == syscall.CTLTYPE_NODE {
+			continue
+		}
+		name, err := syscall.SysctlName(mib)
+		if err != nil {
+			return nil, syscallError("sysctl", err)
+		}
+		// Jailsys parameters are named after their node, with a
+		// trailing dot.
+		name = strings.TrimSuffix(strings.TrimPrefix(name, sysctlParamPrefix), ".")
+		value, err := syscall.SysctlValue(mib)
+		if err != nil {
+			return nil, syscallError("sysctl", err)
+		}
+		if p, ok := sysctlParamInfo(name, kind, format, value); ok {
+			params = append(params, p)
+		}
+	}
+	if len(params) == 0 {
+		return nil, errors.New("no jail parameters found in the sysctl tree")
+	}
+	return NewRegistry(params), nil
+}
+
+func mibHasPrefix(mib, prefix []int32) bool {
+	if len(mib) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if mib[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Derives the parameter description from the sysctl node, the way
+// jailparam_init(3) does.
+func sysctlParamInfo(name string, kind uint32, format string, value []byte) (ParamInfo, bool) {
+	// Like JP_RDTUN in jail(8), parameters which are only tunable, but not
+	// writable, can be set on creation only.
+	p := ParamInfo{
+		Name:       name,
+		ReadOnly:   kind&(syscall.CTLFLAG_WR|syscall.CTLFLAG_TUN) == 0,
+		CreateOnly: kind&(syscall.CTLFLAG_WR|syscall.CTLFLAG_TUN) == syscall.CTLFLAG_TUN,
+	}
+	switch kind & syscall.CTLTYPE {
+	case syscall.CTLTYPE_INT:
+		switch {
+		case format == "B":
+			p.Type = Bool
+		case format == "E,jailsys":
+			p.Type = JailSys
+		default:
+			p.Type = Int
+		}
+	case syscall.CTLTYPE_UINT:
+		p.Type = Uint
+	case syscall.CTLTYPE_LONG:
+		p.Type = Long
+	case syscall.CTLTYPE_ULONG:
+		p.Type = Ulong
+	case syscall.CTLTYPE_STRING:
+		// The value is the maximum length as a decimal string.
+		size, err := strconv.Atoi(cstring(value))
+		if err != nil {
+			return p, false
+		}
+		p.Type = String
+		p.Size = size
+	case syscall.CTLTYPE_STRUCT:
+		// The value is the size of the structure as size_t, the
+		// format is "S,<struct name>" with ",a" appended for arrays.
+		switch len(value) {
+		case 4:
+			p.Size = int(hostByteOrder.Uint32(value))
+		case 8:
+			p.Size = int(hostByteOrder.Uint64(value))
+		default:
+			return p, false
+		}
+		fields := strings.Split(format, ",")
+		switch {
+		case len(fields) > 1 && fields[1] == "in_addr":
+			p.Type = IP4
+		case len(fields) > 1 && fields[1] == "in6_addr":
+			p.Type = IP6
+		default:
+			p.Type = Raw
+		}
+		p.Array = len(fields) > 2 && fields[2] == "a"
+	default:
+		return p, false
+	}
+	return p, true
+}
+
+var (
+	defaultRegistryOnce sync.Once
+	defaultRegistry     *Registry
+)
+
+// DefaultRegistry returns the registry used by the parameter constructors.
+// It is loaded from the running kernel on first use, or the static
+// registry if that fails.
+func DefaultRegistry() *Registry {
+	defaultRegistryOnce.Do(func() {
+		r, err := LoadRegistry()
+		if err != nil {
+			r = StaticRegistry()
+		}
+		defaultRegistry = r
+	})
+	return defaultRegistry
+}
+
+// LookupParam looks up a parameter in the default registry.
+func LookupParam(name string) (ParamInfo, bool) {
+	return DefaultRegistry().Lookup(name)
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"testing"
+
+	"purplekraken.com/pkg/gojail/syscall"
+)
+
+func TestSysctlParamInfo(t *testing.T) {
+	const rw = syscall.CTLFLAG_RD | syscall.CTLFLAG_WR
+	tests := []struct {
+		name   string
+		kind   uint32
+		format string
+		value  []byte
+		want   ParamInfo
+	}{
+		{"securelevel", syscall.CTLTYPE_INT | rw, "I", intToBytes(0),
+			ParamInfo{Name: "securelevel", Type: Int}},
+		{"persist", syscall.CTLTYPE_INT | rw, "B", intToBytes(0),
+			ParamInfo{Name: "persist", Type: Bool}},
+		{"vnet", syscall.CTLTYPE_INT | syscall.CTLFLAG_RD | syscall.CTLFLAG_TUN, "E,jailsys", intToBytes(0),
+			ParamInfo{Name: "vnet", Type: JailSys, CreateOnly: true}},
+		{"path", syscall.CTLTYPE_STRING | syscall.CTLFLAG_RD | syscall.CTLFLAG_TUN, "A", []byte("1024\x00"),
+			ParamInfo{Name: "path", Type: String, Size: 1024, CreateOnly: true}},
+		{"dying", syscall.CTLTYPE_INT | syscall.CTLFLAG_RD, "B", intToBytes(0),
+			ParamInfo{Name: "dying", Type: Bool, ReadOnly: true}},
+		{"allow.mount", syscall.CTLTYPE_INT | rw | syscall.CTLFLAG_TUN, "B", intToBytes(0),
+			ParamInfo{Name: "allow.mount", Type: Bool}},
+		{"host.hostid", syscall.CTLTYPE_ULONG | rw, "LU", make([]byte, 8),
+			ParamInfo{Name: "host.hostid", Type: Ulong}},
+		{"ip6.addr", syscall.CTLTYPE_STRUCT | rw, "S,in6_addr,a", []byte{16, 0, 0, 0, 0, 0, 0, 0},
+			ParamInfo{Name: "ip6.addr", Type: IP6, Size: 16, Array: true}},
+	}
+	for _, test := range tests {
+		got, ok := sysctlParamInfo(test.name, test.kind, test.format, test.value)
+		if !ok || got != test.want {
+			t.Errorf("%s: got %+v, %v, expected %+v", test.name, got, ok, test.want)
+		}
+	}
+}
+
+func TestZeroElementSize(t *testing.T) {
+	// A struct of size 0 must not make decoding addresses loop forever.
+	info, ok := sysctlParamInfo("ip4.addr", syscall.CTLTYPE_STRUCT|syscall.CTLFLAG_RD, "S,in_addr,a", make([]byte, 8))
+	if !ok || info.Size != 0 {
+		t.Fatalf("got %+v, %v", info, ok)
+	}
+	if ips := bytesToIPs(make([]byte, 16), info.Size); ips != nil {
+		t.Errorf("expected no addresses, got %v", ips)
+	}
+}
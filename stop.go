@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	sys "syscall"
+	"time"
+)
+
+const (
+	defaultGracePeriod  = 10 * time.Second
+	defaultKillTimeout  = 2 * time.Second
+	defaultPollInterval = 100 * time.Millisecond
+)
+
+// StopOptions control how Stop shuts down a jail.
+// The zero value is usable.
+type StopOptions struct {
+	// Time the processes have to exit after SIGTERM, before they are
+	// killed. Defaults to 10 seconds.
+	GracePeriod time.Duration
+	// Time to wait for the processes to exit after SIGKILL. Defaults to 2
+	// seconds.
+	KillTimeout time.Duration
+	// Interval in which the processes are checked. Defaults to 100
+	// milliseconds.
+	PollInterval time.Duration
+	// Keep the jail by clearing its persist parameter instead of removing
+	// it, so it goes away once its last process is gone.
+	Keep bool
+	// Process table used to find and signal the processes, defaults to
+	// SystemProcesses.
+	Processes ProcessTable
+}
+
+// StopReport lists the processes of the jail at each stage of Stop.
+type StopReport struct {
+	Terminated []Process // Processes sent SIGTERM
+	Killed     []Process // Processes still alive after the grace period, sent SIGKILL
+	Remaining  []Process // Processes still alive after SIGKILL
+}
+
+// Stop shuts down the jail jid gracefully: it sends SIGTERM to all its
+// processes, waits for them to exit for the grace period, sends SIGKILL to
+// the ones left and then removes the jail, or clears its persist parameter
+// if opts.Keep is set.
+// Processes started while waiting are sent SIGTERM as well.
+// Unlike Remove alone, this gives services in the jail the chance to shut
+// down cleanly.
+//
+// The report lists which processes were alive at each stage, also if Stop
+// fails. If ctx is done before the processes exit, Stop returns the error
+// of the context without removing the jail.
+func Stop(ctx context.Context, jid int, opts *StopOptions) (*StopReport, error) {
+	var o StopOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.GracePeriod <= 0 {
+		o.GracePeriod = defaultGracePeriod
+	}
+	if o.KillTimeout <= 0 {
+		o.KillTimeout = defaultKillTimeout
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultPollInterval
+	}
+	if o.Processes == nil {
+		o.Processes = SystemProcesses
+	}
+
+	// Fail early for jails which do not exist.
+	if _, err := GetName(jid); err != nil {
+		return nil, err
+	}
+	report := &StopReport{}
+	left, err := terminate(ctx, o.Processes, jid, o.GracePeriod, o.PollInterval, report)
+	if err != nil {
+		return report, err
+	}
+	if len(left) > 0 {
+		report.Killed = left
+		kill := func(procs []Process) error {
+			for _, p := range procs {
+				if err := signalProcess(o.Processes, p, sys.SIGKILL); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		left, err = waitProcesses(ctx, o.Processes, jid, o.KillTimeout, o.PollInterval, kill)
+		if err != nil {
+			return report, err
+		}
+		report.Remaining = left
+	}
+
+	if o.Keep {
+		persist, err := NewIntParam("persist", 0)
+		if err == nil {
+			_, err = SetParams([]JailParam{jidParam(jid), persist}, UpdateFlag)
+		}
+		if errors.Is(err, ErrNotFound) {
+			// The jail went away with its last process.
+			err = nil
+		}
+		return report, err
+	}
+	if err := Remove(jid); err != nil && !errors.Is(err, ErrNotFound) {
+		return report, err
+	}
+	return report, nil
+}
+
+// Terminate sends SIGTERM to the processes of the jail jid and waits at
+// most timeout for them to exit, without killing the processes left or
+// removing the jail. Processes started while waiting are sent SIGTERM as
+// well. It returns the processes still alive; t defaults to
+// SystemProcesses.
+func Terminate(ctx context.Context, jid int, timeout time.Duration, t ProcessTable) ([]Process, error) {
+	if t == nil {
+		t = SystemProcesses
+	}
+	return terminate(ctx, t, jid, timeout, defaultPollInterval, &StopReport{})
+}
+
+// Sends SIGTERM to the processes of the jail jid until they exit or
+// timeout expires, recording them in report.Terminated.
+func terminate(ctx context.Context, t ProcessTable, jid int, timeout, interval time.Duration, report *StopReport) ([]Process, error) {
+	signalled := make(map[int]bool)
+	return waitProcesses(ctx, t, jid, timeout, interval, func(procs []Process) error {
+		for _, p := range procs {
+			if signalled[p.PID] {
+				continue
+			}
+			signalled[p.PID] = true
+			report.Terminated = append(report.Terminated, p)
+			if err := signalProcess(t, p, sys.SIGTERM); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Sends sig to p, ignoring processes which exited in the meantime.
+func signalProcess(t ProcessTable, p Process, sig sys.Signal) error {
+	if err := t.Signal(p.PID, sig); err != nil && err != sys.ESRCH {
+		return fmt.Errorf("signal %v to process %d (%s): %w", sig, p.PID, p.Command, os.NewSyscallError("kill", err))
+	}
+	return nil
+}
+
+// Calls signal with the processes of the jail jid until none are left or
+// timeout expires, and returns the processes left.
+func waitProcesses(ctx context.Context, t ProcessTable, jid int, timeout, interval time.Duration, signal func([]Process) error) ([]Process, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		procs, err := t.Processes(jid)
+		if err != nil {
+			return nil, err
+		}
+		if len(procs) == 0 {
+			return nil, nil
+		}
+		if err := signal(procs); err != nil {
+			return procs, err
+		}
+		select {
+		case <-ctx.Done():
+			return procs, ctx.Err()
+		case <-timer.C:
+			return t.Processes(jid)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+//go:build freebsd
+// +build freebsd
+
+package syscall
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// struct ifreq in net/if.h, with the union as raw bytes.
+type ifreq struct {
+	name [unix.IFNAMSIZ]byte
+	ifru [16]byte
+}
+
+func newIfreq(name string) (*ifreq, error) {
+	ifn, err := ifname(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ifreq{name: ifn}, nil
+}
+
+// struct ifdrv in net/if.h.
+type ifdrv struct {
+	name [unix.IFNAMSIZ]byte
+	cmd  uintptr
+	len  uintptr
+	data unsafe.Pointer
+}
+
+// struct ifbreq in net/if_bridgevar.h.
+type ifbreq struct {
+	ifsname      [unix.IFNAMSIZ]byte
+	ifsflags     uint32
+	stpflags     uint32
+	pathCost     uint32
+	portno       uint8
+	priority     uint8
+	proto        uint8
+	role         uint8
+	state        uint8
+	addrcnt      uint32
+	addrmax      uint32
+	addrexceeded uint32
+	pad          [32]uint8
+}
+
+// Commands of the bridge(4) driver in net/if_bridgevar.h.
+const (
+	brdgadd = 0
+	brdgdel = 1
+)
+
+// IfCreate creates an interface of the cloner given by name, like
+// "epair" or "bridge", and returns the name of the new interface.
+// For epair(4), this is the name of the a end, like "epair0a".
+func IfCreate(name string) (string, error) {
+	req, err := newIfreq(name)
+	if err != nil {
+		return "", err
+	}
+	if err := ifioctl(unix.AF_LOCAL, unix.SIOCIFCREATE2, unsafe.Pointer(req)); err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(req.name[:]), nil
+}
+
+// IfDestroy destroys the interface called name.
+func IfDestroy(name string) error {
+	req, err := newIfreq(name)
+	if err != nil {
+		return err
+	}
+	return ifioctl(unix.AF_LOCAL, unix.SIOCIFDESTROY, unsafe.Pointer(req))
+}
+
+// Issues one of the SIOCSIFVNET and SIOCSIFRVNET ioctls, which take the
+// JID in ifr_jid.
+func ifvnet(req uintptr, name string, jid int) error {
+	r, err := newIfreq(name)
+	if err != nil {
+		return err
+	}
+	*(*int32)(unsafe.Pointer(&r.ifru[0])) = int32(jid)
+	return ifioctl(unix.AF_LOCAL, req, unsafe.Pointer(r))
+}
+
+// IfSetVnet moves the interface called name into the network stack of the
+// jail jid.
+func IfSetVnet(name string, jid int) error {
+	return ifvnet(unix.SIOCSIFVNET, name, jid)
+}
+
+// IfReclaimVnet moves the interface called name from the network stack of
+// the jail jid back to the one of the calling process.
+func IfReclaimVnet(name string, jid int) error {
+	return ifvnet(unix.SIOCSIFRVNET, name, jid)
+}
+
+// IfRename renames the interface called name to newName.
+func IfRename(name, newName string) error {
+	req, err := newIfreq(name)
+	if err != nil {
+		return err
+	}
+	nb, err := ifname(newName)
+	if err != nil {
+		return err
+	}
+	*(*unsafe.Pointer)(unsafe.Pointer(&req.ifru[0])) = unsafe.Pointer(&nb[0])
+	err = ifioctl(unix.AF_LOCAL, unix.SIOCSIFNAME, unsafe.Pointer(req))
+	runtime.KeepAlive(&nb)
+	return err
+}
+
+// IfSetUp sets the IFF_UP flag of the interface called name.
+func IfSetUp(name string) error {
+	req, err := newIfreq(name)
+	if err != nil {
+		return err
+	}
+	if err := ifioctl(unix.AF_LOCAL, unix.SIOCGIFFLAGS, unsafe.Pointer(req)); err != nil {
+		return err
+	}
+	// ifr_flags, followed by ifr_flagshigh.
+	flags := (*int16)(unsafe.Pointer(&req.ifru[0]))
+	*flags |= unix.IFF_UP
+	return ifioctl(unix.AF_LOCAL, unix.SIOCSIFFLAGS, unsafe.Pointer(req))
+}
+
+// Runs the bridge(4) command cmd for the member interface.
+func bridgeCmd(bridge, member string, cmd uintptr) error {
+	bn, err := ifname(bridge)
+	if err != nil {
+		return err
+	}
+	mn, err := ifname(member)
+	if err != nil {
+		return err
+	}
+	br := ifbreq{ifsname: mn}
+	drv := ifdrv{name: bn, cmd: cmd, len: unsafe.Sizeof(br), data: unsafe.Pointer(&br)}
+	err = ifioctl(unix.AF_LOCAL, unix.SIOCSDRVSPEC, unsafe.Pointer(&drv))
+	runtime.KeepAlive(&br)
+	return err
+}
+
+// BridgeAdd adds the interface member to the bridge called bridge.
+func BridgeAdd(bridge, member string) error {
+	return bridgeCmd(bridge, member, brdgadd)
+}
+
+// BridgeDelete removes the interface member from the bridge called
+// bridge.
+func BridgeDelete(bridge, member string) error {
+	return bridgeCmd(bridge, member, brdgdel)
+}
@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+//go:build freebsd
+// +build freebsd
+
+package syscall
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// struct sockaddr_in in netinet/in.h.
+type sockaddrIn struct {
+	len    uint8
+	family uint8
+	port   uint16
+	addr   [4]byte
+	zero   [8]byte
+}
+
+// struct in_aliasreq in netinet/in_var.h.
+type inAliasreq struct {
+	name      [unix.IFNAMSIZ]byte
+	addr      sockaddrIn
+	broadaddr sockaddrIn
+	mask      sockaddrIn
+	vhid      int32
+}
+
+// struct ifreq in net/if.h, with an address.
+type ifreqAddr struct {
+	name [unix.IFNAMSIZ]byte
+	addr sockaddrIn
+}
+
+// struct sockaddr_in6 in netinet6/in6.h.
+type sockaddrIn6 struct {
+	len      uint8
+	family   uint8
+	port     uint16
+	flowinfo uint32
+	addr     [16]byte
+	scopeID  uint32
+}
+
+// struct in6_aliasreq in netinet6/in6_var.h, up to ifra_flags.
+// It is followed by struct in6_addrlifetime, whose size depends on time_t,
+// and ifra_vhid, so the structure is passed as a byte array.
+type in6Aliasreq struct {
+	name       [unix.IFNAMSIZ]byte
+	addr       sockaddrIn6
+	dstaddr    sockaddrIn6
+	prefixmask sockaddrIn6
+	flags      int32
+}
+
+// struct in6_ifreq in netinet6/in6_var.h, with an address. The union of
+// the structure is dominated by struct icmp6_ifstat.
+type in6IfreqAddr struct {
+	name [unix.IFNAMSIZ]byte
+	addr sockaddrIn6
+	pad  [272 - 28]byte
+}
+
+const nd6InfiniteLifetime = 0xffffffff // ND6_INFINITE_LIFETIME in netinet6/nd6.h
+
+// Size of time_t, which has 32 bits on i386 only.
+var timeSize = func() uintptr {
+	if runtime.GOARCH == "386" {
+		return 4
+	}
+	return 8
+}()
+
+// Size of struct in6_aliasreq and the offset of ia6t_vltime, which
+// follows the two time_t fields of ifra_lifetime at the end of
+// in6Aliasreq. ia6t_pltime and ifra_vhid follow, then padding to the
+// alignment of time_t.
+var (
+	in6AliasreqVltime = unsafe.Sizeof(in6Aliasreq{}) + 2*timeSize
+	in6AliasreqSize   = (in6AliasreqVltime + 12 + timeSize - 1) &^ (timeSize - 1)
+)
+
+// _IOW(g, n, t) in sys/ioccom.h.
+func iow(g, n byte, size uintptr) uintptr {
+	return 0x80000000 | (size&0x1fff)<<16 | uintptr(g)<<8 | uintptr(n)
+}
+
+// Request codes of sys/sockio.h and netinet6/in6_var.h, the ones of
+// golang.org/x/sys/unix are outdated.
+var (
+	siocaifaddr    = iow('i', 43, unsafe.Sizeof(inAliasreq{}))
+	siocdifaddr    = iow('i', 25, unsafe.Sizeof(ifreqAddr{}))
+	siocaifaddrIn6 = iow('i', 27, in6AliasreqSize)
+	siocdifaddrIn6 = iow('i', 25, unsafe.Sizeof(in6IfreqAddr{}))
+)
+
+func ifname(name string) ([unix.IFNAMSIZ]byte, error) {
+	var b [unix.IFNAMSIZ]byte
+	if len(name) == 0 || len(name) >= len(b) {
+		return b, errEINVAL
+	}
+	copy(b[:], name)
+	return b, nil
+}
+
+// Issues the ioctl req on a datagram socket of the address family af.
+func ifioctl(af int, req uintptr, arg unsafe.Pointer) error {
+	fd, err := unix.Socket(af, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	_, _, e := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+	return errnoErr(e)
+}
+
+func inet(addr [4]byte) sockaddrIn {
+	return sockaddrIn{len: uint8(unsafe.Sizeof(sockaddrIn{})), family: unix.AF_INET, addr: addr}
+}
+
+func inet6(addr [16]byte) sockaddrIn6 {
+	return sockaddrIn6{len: uint8(unsafe.Sizeof(sockaddrIn6{})), family: unix.AF_INET6, addr: addr}
+}
+
+// AddInetAlias adds the IPv4 address addr with the netmask mask to the
+// interface called name, like "ifconfig name inet addr netmask mask
+// alias".
+func AddInetAlias(name string, addr, mask [4]byte) error {
+	ifn, err := ifname(name)
+	if err != nil {
+		return err
+	}
+	req := inAliasreq{name: ifn, addr: inet(addr), mask: inet(mask)}
+	err = ifioctl(unix.AF_INET, siocaifaddr, unsafe.Pointer(&req))
+	runtime.KeepAlive(&req)
+	return err
+}
+
+// DeleteInetAlias removes the IPv4 address addr from the interface called
+// name.
+func DeleteInetAlias(name string, addr [4]byte) error {
+	ifn, err := ifname(name)
+	if err != nil {
+		return err
+	}
+	req := ifreqAddr{name: ifn, addr: inet(addr)}
+	err = ifioctl(unix.AF_INET, siocdifaddr, unsafe.Pointer(&req))
+	runtime.KeepAlive(&req)
+	return err
+}
+
+// AddInet6Alias adds the IPv6 address addr with the prefix mask mask to
+// the interface called name, with infinite lifetime, like "ifconfig name
+// inet6 addr prefixlen len alias".
+func AddInet6Alias(name string, addr, mask [16]byte) error {
+	ifn, err := ifname(name)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, in6AliasreqSize)
+	req := (*in6Aliasreq)(unsafe.Pointer(&buf[0]))
+	req.name = ifn
+	req.addr = inet6(addr)
+	req.prefixmask = inet6(mask)
+	vltime := (*[2]uint32)(unsafe.Pointer(&buf[in6AliasreqVltime]))
+	vltime[0] = nd6InfiniteLifetime // ia6t_vltime
+	vltime[1] = nd6InfiniteLifetime // ia6t_pltime
+	err = ifioctl(unix.AF_INET6, siocaifaddrIn6, unsafe.Pointer(&buf[0]))
+	runtime.KeepAlive(buf)
+	return err
+}
+
+// DeleteInet6Alias removes the IPv6 address addr from the interface called
+// name.
+func DeleteInet6Alias(name string, addr [16]byte) error {
+	ifn, err := ifname(name)
+	if err != nil {
+		return err
+	}
+	req := in6IfreqAddr{name: ifn, addr: inet6(addr)}
+	err = ifioctl(unix.AF_INET6, siocdifaddrIn6, unsafe.Pointer(&req))
+	runtime.KeepAlive(&req)
+	return err
+}
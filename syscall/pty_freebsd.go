@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+//go:build freebsd
+// +build freebsd
+
+package syscall
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Argument of the FIODGNAME ioctl, struct fiodgname_arg in sys/filio.h.
+type fiodgnameArg struct {
+	len int32
+	buf unsafe.Pointer
+}
+
+// _IOW('f', 120, struct fiodgname_arg) in sys/filio.h
+var fiodgname = 0x80000000 | (unsafe.Sizeof(fiodgnameArg{})&0x1fff)<<16 | 'f'<<8 | 120
+
+// PosixOpenpt calls posix_openpt(2).
+func PosixOpenpt(flags int) (int, error) {
+	fd, _, e := unix.Syscall(unix.SYS_POSIX_OPENPT, uintptr(flags), 0, 0)
+	if e != 0 {
+		return -1, errnoErr(e)
+	}
+	return int(fd), nil
+}
+
+// Ptsname returns the path of the terminal device of the pseudo-terminal
+// controller fd, like ptsname(3).
+func Ptsname(fd int) (string, error) {
+	if _, _, e := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.TIOCPTMASTER, 0); e != 0 {
+		return "", errnoErr(e)
+	}
+	buf := make([]byte, 64)
+	arg := fiodgnameArg{len: int32(len(buf)), buf: unsafe.Pointer(&buf[0])}
+	if _, _, e := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), fiodgname, uintptr(unsafe.Pointer(&arg))); e != 0 {
+		return "", errnoErr(e)
+	}
+	return "/dev/" + unix.ByteSliceToString(buf), nil
+}
@@ -57,12 +57,7 @@
 // Low-level implementation of jail-related syscalls.
 package syscall // import "purplekraken.com/pkg/gojail/syscall"
 
-import (
-	"syscall"
-	"unsafe"
-
-	"golang.org/x/sys/unix"
-)
+import "syscall"
 
 const (
 	JAIL_CREATE = 0x01 // Create jail if it does not exist
@@ -106,51 +101,3 @@ func errnoErr(e syscall.Errno) error {
 	}
 	return e
 }
-
-func syscall1(sysnum uintptr, jid int) error {
-	_, _, e := unix.Syscall(sysnum, uintptr(jid), 0, 0)
-	return errnoErr(e)
-}
-
-func JailAttach(jid int) error {
-	return syscall1(unix.SYS_JAIL_ATTACH, jid)
-}
-
-func JailRemove(jid int) error {
-	return syscall1(unix.SYS_JAIL_REMOVE, jid)
-}
-
-var _zero uintptr
-
-func bytes2iovec(bs [][]byte) []syscall.Iovec {
-	iovecs := make([]syscall.Iovec, len(bs))
-	for i, b := range bs {
-		iovecs[i].SetLen(len(b))
-		if len(b) > 0 {
-			iovecs[i].Base = &b[0]
-		} else {
-			iovecs[i].Base = (*byte)(unsafe.Pointer(&_zero))
-		}
-	}
-	return iovecs
-}
-
-func syscall2(sysnum uintptr, params [][]byte, flags int) (int, error) {
-	iovs := bytes2iovec(params)
-	var p unsafe.Pointer
-	if len(iovs) > 0 {
-		p = unsafe.Pointer(&iovs[0])
-	} else {
-		p = unsafe.Pointer(&_zero)
-	}
-	jid, _, e := unix.Syscall(sysnum, uintptr(p), uintptr(len(iovs)), uintptr(flags))
-	return int(jid), errnoErr(e)
-}
-
-func JailGet(params [][]byte, flags int) (int, error) {
-	return syscall2(unix.SYS_JAIL_GET, params, flags)
-}
-
-func JailSet(params [][]byte, flags int) (int, error) {
-	return syscall2(unix.SYS_JAIL_SET, params, flags)
-}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+//go:build freebsd
+// +build freebsd
+
+package syscall
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func syscall1(sysnum uintptr, jid int) error {
+	_, _, e := unix.Syscall(sysnum, uintptr(jid), 0, 0)
+	return errnoErr(e)
+}
+
+func JailAttach(jid int) error {
+	return syscall1(unix.SYS_JAIL_ATTACH, jid)
+}
+
+func JailRemove(jid int) error {
+	return syscall1(unix.SYS_JAIL_REMOVE, jid)
+}
+
+var _zero uintptr
+
+func bytes2iovec(bs [][]byte) []syscall.Iovec {
+	iovecs := make([]syscall.Iovec, len(bs))
+	for i, b := range bs {
+		iovecs[i].SetLen(len(b))
+		if len(b) > 0 {
+			iovecs[i].Base = &b[0]
+		} else {
+			iovecs[i].Base = (*byte)(unsafe.Pointer(&_zero))
+		}
+	}
+	return iovecs
+}
+
+func syscall2(sysnum uintptr, iovs []syscall.Iovec, flags int) (int, error) {
+	var p unsafe.Pointer
+	if len(iovs) > 0 {
+		p = unsafe.Pointer(&iovs[0])
+	} else {
+		p = unsafe.Pointer(&_zero)
+	}
+	jid, _, e := unix.Syscall(sysnum, uintptr(p), uintptr(len(iovs)), uintptr(flags))
+	return int(jid), errnoErr(e)
+}
+
+// JailGet calls jail_get(2).
+// The kernel reports the length of each value it returns in the iovec array,
+// the value slices in params are shortened accordingly.
+// For empty values, the kernel only reports the length without copying the
+// value, they are replaced by zeroed slices of that length.
+func JailGet(params [][]byte, flags int) (int, error) {
+	iovs := bytes2iovec(params)
+	jid, err := syscall2(unix.SYS_JAIL_GET, iovs, flags)
+	for i := range params {
+		n := int(iovs[i].Len)
+		if len(params[i]) == 0 && n > 0 {
+			params[i] = make([]byte, n)
+		} else if n < len(params[i]) {
+			params[i] = params[i][:n]
+		}
+	}
+	return jid, err
+}
+
+func JailSet(params [][]byte, flags int) (int, error) {
+	return syscall2(unix.SYS_JAIL_SET, bytes2iovec(params), flags)
+}
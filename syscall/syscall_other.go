@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+//go:build !freebsd
+// +build !freebsd
+
+package syscall
+
+import "syscall"
+
+// Jails are a FreeBSD feature, on other systems every system call fails
+// with ENOSYS.
+
+func JailAttach(jid int) error {
+	return syscall.ENOSYS
+}
+
+func JailRemove(jid int) error {
+	return syscall.ENOSYS
+}
+
+func JailGet(params [][]byte, flags int) (int, error) {
+	return -1, syscall.ENOSYS
+}
+
+func JailSet(params [][]byte, flags int) (int, error) {
+	return -1, syscall.ENOSYS
+}
+
+func SysctlNameToMIB(name string) ([]int32, error) {
+	return nil, syscall.ENOSYS
+}
+
+func SysctlNext(mib []int32) ([]int32, error) {
+	return nil, syscall.ENOSYS
+}
+
+func SysctlName(mib []int32) (string, error) {
+	return "", syscall.ENOSYS
+}
+
+func SysctlFormat(mib []int32) (uint32, string, error) {
+	return 0, "", syscall.ENOSYS
+}
+
+func SysctlValue(mib []int32) ([]byte, error) {
+	return nil, syscall.ENOSYS
+}
+
+func PosixOpenpt(flags int) (int, error) {
+	return -1, syscall.ENOSYS
+}
+
+func Ptsname(fd int) (string, error) {
+	return "", syscall.ENOSYS
+}
+
+func AddInetAlias(name string, addr, mask [4]byte) error {
+	return syscall.ENOSYS
+}
+
+func DeleteInetAlias(name string, addr [4]byte) error {
+	return syscall.ENOSYS
+}
+
+func AddInet6Alias(name string, addr, mask [16]byte) error {
+	return syscall.ENOSYS
+}
+
+func DeleteInet6Alias(name string, addr [16]byte) error {
+	return syscall.ENOSYS
+}
+
+func IfCreate(name string) (string, error) {
+	return "", syscall.ENOSYS
+}
+
+func IfDestroy(name string) error {
+	return syscall.ENOSYS
+}
+
+func IfSetVnet(name string, jid int) error {
+	return syscall.ENOSYS
+}
+
+func IfReclaimVnet(name string, jid int) error {
+	return syscall.ENOSYS
+}
+
+func IfRename(name, newName string) error {
+	return syscall.ENOSYS
+}
+
+func IfSetUp(name string) error {
+	return syscall.ENOSYS
+}
+
+func BridgeAdd(bridge, member string) error {
+	return syscall.ENOSYS
+}
+
+func BridgeDelete(bridge, member string) error {
+	return syscall.ENOSYS
+}
+
+func Nmount(params [][]byte, flags int) error {
+	return syscall.ENOSYS
+}
+
+func Unmount(path string, flags int) error {
+	return syscall.ENOSYS
+}
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package syscall
+
+// Types and flags of sysctl nodes, defined in sys/sysctl.h.
+const (
+	CTLTYPE        = 0xf // Mask for the type
+	CTLTYPE_NODE   = 1   // Name is a node
+	CTLTYPE_INT    = 2   // Name describes an integer
+	CTLTYPE_STRING = 3   // Name describes a string
+	CTLTYPE_S64    = 4   // Name describes a signed 64-bit number
+	CTLTYPE_OPAQUE = 5   // Name describes a structure
+	CTLTYPE_STRUCT = CTLTYPE_OPAQUE
+	CTLTYPE_UINT   = 6 // Name describes an unsigned integer
+	CTLTYPE_LONG   = 7 // Name describes a long
+	CTLTYPE_ULONG  = 8 // Name describes an unsigned long
+	CTLTYPE_U64    = 9 // Name describes an unsigned 64-bit number
+
+	CTLFLAG_RD  = 0x80000000 // Allow reads of variable
+	CTLFLAG_WR  = 0x40000000 // Allow writes to the variable
+	CTLFLAG_TUN = 0x00080000 // Default value is loaded from getenv()
+)
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+//go:build freebsd
+// +build freebsd
+
+package syscall
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const ctlMaxName = 24 // CTL_MAXNAME in sys/sysctl.h
+
+func sysctl(mib []int32, old unsafe.Pointer, oldlen *uintptr, new unsafe.Pointer, newlen uintptr) error {
+	_, _, e := unix.Syscall6(unix.SYS___SYSCTL,
+		uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+		uintptr(old), uintptr(unsafe.Pointer(oldlen)),
+		uintptr(new), newlen)
+	return errnoErr(e)
+}
+
+// Calls one of the sysctl(3) meta-nodes below {0}, which return a MIB.
+func sysctlMIB(mib []int32, new unsafe.Pointer, newlen uintptr) ([]int32, error) {
+	var buf [ctlMaxName]int32
+	n := uintptr(len(buf)) * 4
+	if err := sysctl(mib, unsafe.Pointer(&buf[0]), &n, new, newlen); err != nil {
+		return nil, err
+	}
+	return append([]int32(nil), buf[:n/4]...), nil
+}
+
+// SysctlNameToMIB returns the MIB of the sysctl node called name.
+func SysctlNameToMIB(name string) ([]int32, error) {
+	b := []byte(name)
+	if len(b) == 0 {
+		return nil, errEINVAL
+	}
+	return sysctlMIB([]int32{0, 3}, unsafe.Pointer(&b[0]), uintptr(len(b)))
+}
+
+// SysctlNext returns the MIB of the node following mib in the sysctl tree.
+// At the end of the tree, the error is ENOENT.
+func SysctlNext(mib []int32) ([]int32, error) {
+	return sysctlMIB(append([]int32{0, 2}, mib...), nil, 0)
+}
+
+// SysctlName returns the name of the sysctl node identified by mib.
+func SysctlName(mib []int32) (string, error) {
+	buf := make([]byte, 1024)
+	n := uintptr(len(buf))
+	if err := sysctl(append([]int32{0, 1}, mib...), unsafe.Pointer(&buf[0]), &n, nil, 0); err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(buf[:n]), nil
+}
+
+// SysctlFormat returns the kind and the format string of the sysctl node
+// identified by mib.
+// The kind contains the type of the node and its CTLFLAG values.
+func SysctlFormat(mib []int32) (uint32, string, error) {
+	buf := make([]byte, 1024)
+	n := uintptr(len(buf))
+	if err := sysctl(append([]int32{0, 4}, mib...), unsafe.Pointer(&buf[0]), &n, nil, 0); err != nil {
+		return 0, "", err
+	}
+	if n < 4 {
+		return 0, "", errEINVAL
+	}
+	kind := *(*uint32)(unsafe.Pointer(&buf[0]))
+	return kind, unix.ByteSliceToString(buf[4:n]), nil
+}
+
+// SysctlValue returns the raw value of the sysctl node identified by mib.
+func SysctlValue(mib []int32) ([]byte, error) {
+	var n uintptr
+	if err := sysctl(mib, nil, &n, nil, 0); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if n == 0 {
+		return buf, nil
+	}
+	if err := sysctl(mib, unsafe.Pointer(&buf[0]), &n, nil, 0); err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: BSD-2-Clause-FreeBSD
+//
+// Copyright (c) 2020 Florian Limberger <flo@purplekraken.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package gojail
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// IsDying reports whether the jail jid was removed, but still lingers in
+// the dying state until its last references, like sockets, are released.
+// If there is no jail jid, the error matches ErrNotFound.
+func IsDying(jid int) (bool, error) {
+	dying, err := IntOut("dying")
+	if err != nil {
+		return false, err
+	}
+	if _, err := GetParams([]JailParam{jidParam(jid), dying}, AllowDyingFlag); err != nil {
+		return false, err
+	}
+	return dying.Value() != 0, nil
+}
+
+// WaitGone waits until the jail jid is gone, including the dying state,
+// by polling it every 100 milliseconds.
+// Only then can its name and addresses be used by a new jail.
+// If ctx is done before, WaitGone returns the error of the context.
+// A new jail reusing the JID counts as the jail being gone, recognized by
+// a different name, or by no longer dying after the jail was seen dying.
+func WaitGone(ctx context.Context, jid int) error {
+	name, dying, err := dyingState(jid)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(defaultPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		current, stillDying, err := dyingState(jid)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if current != name || (dying && !stillDying) {
+			return nil
+		}
+		dying = stillDying
+	}
+}
+
+// Returns the name of the jail jid, which may be dying, and whether it is
+// dying.
+func dyingState(jid int) (string, bool, error) {
+	name, err := StringOut("name")
+	if err != nil {
+		return "", false, err
+	}
+	dying, err := IntOut("dying")
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := GetParams([]JailParam{jidParam(jid), name, dying}, AllowDyingFlag); err != nil {
+		return "", false, err
+	}
+	return name.Value(), dying.Value() != 0, nil
+}
+
+// RemoveOption changes the behavior of Remove.
+type RemoveOption func(*removeOptions)
+
+type removeOptions struct {
+	wait context.Context
+}
+
+// WaitUntilGone makes Remove wait until the jail is gone, see WaitGone.
+// The removal itself is not affected by ctx, only the waiting.
+func WaitUntilGone(ctx context.Context) RemoveOption {
+	return func(o *removeOptions) {
+		o.wait = ctx
+	}
+}